@@ -0,0 +1,442 @@
+package sling
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	awsAlgorithm        = "AWS4-HMAC-SHA256"
+	awsTimeFormat       = "20060102T150405Z"
+	awsDateFormat       = "20060102"
+	awsUnsignedPayload  = "UNSIGNED-PAYLOAD"
+	awsStreamingPayload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	awsChunkAlgorithm   = "AWS4-HMAC-SHA256-PAYLOAD"
+	awsEmptySHA256      = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	awsDefaultChunkSize = 64 * 1024
+)
+
+// AWSPayloadMode is how an AWSSigner signs the request body.
+type AWSPayloadMode int
+
+const (
+	// AWSSignedPayload signs the SHA-256 hash of the whole body.
+	AWSSignedPayload AWSPayloadMode = iota
+	// AWSUnsignedPayload signs the literal "UNSIGNED-PAYLOAD" instead of the
+	// body hash, so the body is not read before sending. Supported by S3.
+	AWSUnsignedPayload
+	// AWSStreamingPayload sends the body with aws-chunked encoding, signing
+	// each chunk as it is sent. The request ContentLength must be known.
+	// Supported by S3.
+	AWSStreamingPayload
+)
+
+// AWSSigner signs requests with AWS Signature Version 4. Add it to a Sling
+// with Signer to sign requests in headers, or use Presign for presigned URLs.
+// See https://docs.aws.amazon.com/IAM/latest/UserGuide/reference_aws-signing.html.
+type AWSSigner struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken of temporary credentials, sent as X-Amz-Security-Token.
+	SessionToken string
+	Region       string
+	// Service is the signing name of the service, such as "s3" or
+	// "execute-api". For "s3", paths are neither normalized nor escaped twice
+	// and the X-Amz-Content-Sha256 header is always sent.
+	Service     string
+	PayloadMode AWSPayloadMode
+	// ChunkSize of AWSStreamingPayload chunks, by default 64 KB.
+	ChunkSize int
+}
+
+// awsNow returns the time requests are signed at.
+var awsNow = time.Now
+
+// Sign signs the request with an Authorization header.
+func (a *AWSSigner) Sign(req *http.Request) error {
+	t := a.time()
+	amzDate := t.Format(awsTimeFormat)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if a.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", a.SessionToken)
+	}
+
+	payloadHash, err := a.payloadHash(req)
+	if err != nil {
+		return err
+	}
+	if a.Service == "s3" || a.PayloadMode != AWSSignedPayload {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+	if a.PayloadMode == AWSStreamingPayload {
+		if err := a.prepareStreaming(req); err != nil {
+			return err
+		}
+	}
+
+	signedHeaders, canonicalHeaders := awsCanonicalHeaders(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		a.canonicalURI(req.URL),
+		awsCanonicalQuery(req.URL.RawQuery),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := a.scope(t)
+	signature := a.signature(t, awsStringToSign(amzDate, scope, canonicalRequest))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		awsAlgorithm, a.AccessKeyID, scope, signedHeaders, signature))
+
+	if a.PayloadMode == AWSStreamingPayload && req.Body != nil {
+		req.Body = &awsChunkedReader{
+			signer:    a,
+			body:      req.Body,
+			amzDate:   amzDate,
+			scope:     scope,
+			t:         t,
+			prevSig:   signature,
+			chunkSize: a.chunkSize(),
+		}
+		req.GetBody = nil
+	}
+	return nil
+}
+
+// Presign returns the request URL with a SigV4 signature in its query, valid
+// for expires. Only the host header and any X-Amz-* headers of the request
+// are signed, and the payload is unsigned.
+func (a *AWSSigner) Presign(req *http.Request, expires time.Duration) (string, error) {
+	t := a.time()
+	amzDate := t.Format(awsTimeFormat)
+	scope := a.scope(t)
+
+	u := *req.URL
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", awsAlgorithm)
+	query.Set("X-Amz-Credential", a.AccessKeyID+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.FormatInt(int64(expires/time.Second), 10))
+	if a.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", a.SessionToken)
+	}
+
+	signed := &http.Request{Method: req.Method, URL: &u, Host: req.Host, Header: make(http.Header)}
+	for key, values := range req.Header {
+		if strings.HasPrefix(key, "X-Amz-") {
+			signed.Header[key] = values
+		}
+	}
+	signedHeaders, canonicalHeaders := awsCanonicalHeaders(signed)
+	query.Set("X-Amz-SignedHeaders", signedHeaders)
+	u.RawQuery = awsEncodeQuery(query)
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		a.canonicalURI(&u),
+		awsCanonicalQuery(u.RawQuery),
+		canonicalHeaders,
+		signedHeaders,
+		awsUnsignedPayload,
+	}, "\n")
+	signature := a.signature(t, awsStringToSign(amzDate, scope, canonicalRequest))
+	u.RawQuery += "&X-Amz-Signature=" + signature
+	return u.String(), nil
+}
+
+// Presign builds a new http.Request from the Sling properties and returns
+// its URL presigned by the signer, valid for expires.
+func (s *Sling) Presign(signer *AWSSigner, expires time.Duration) (string, error) {
+	req, err := s.request()
+	if err != nil {
+		return "", err
+	}
+	return signer.Presign(req, expires)
+}
+
+func (a *AWSSigner) time() time.Time {
+	return awsNow().UTC()
+}
+
+func (a *AWSSigner) scope(t time.Time) string {
+	return strings.Join([]string{t.Format(awsDateFormat), a.Region, a.Service, "aws4_request"}, "/")
+}
+
+func (a *AWSSigner) chunkSize() int {
+	if a.ChunkSize > 0 {
+		return a.ChunkSize
+	}
+	return awsDefaultChunkSize
+}
+
+// signature derives the signing key for the date, region and service and
+// signs the string to sign.
+func (a *AWSSigner) signature(t time.Time, stringToSign string) string {
+	key := hmacSHA256([]byte("AWS4"+a.SecretAccessKey), t.Format(awsDateFormat))
+	key = hmacSHA256(key, a.Region)
+	key = hmacSHA256(key, a.Service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// payloadHash returns the hashed payload of the canonical request. Signed
+// payloads are read from GetBody when possible, otherwise the body is
+// buffered.
+func (a *AWSSigner) payloadHash(req *http.Request) (string, error) {
+	switch a.PayloadMode {
+	case AWSUnsignedPayload:
+		return awsUnsignedPayload, nil
+	case AWSStreamingPayload:
+		return awsStreamingPayload, nil
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		return awsEmptySHA256, nil
+	}
+	var body io.Reader
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return "", err
+		}
+		defer rc.Close()
+		body = rc
+	} else {
+		b, err := readRequestBody(req)
+		if err != nil {
+			return "", err
+		}
+		body = bytes.NewReader(b)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// prepareStreaming sets the headers of an aws-chunked request, including the
+// encoded Content-Length, which is signed.
+func (a *AWSSigner) prepareStreaming(req *http.Request) error {
+	decodedLength := req.ContentLength
+	if req.Body == nil || req.Body == http.NoBody {
+		decodedLength = 0
+	}
+	if decodedLength < 0 {
+		return fmt.Errorf("sigv4: streaming payloads require a known ContentLength")
+	}
+	encodedLength := awsChunkedLength(decodedLength, int64(a.chunkSize()))
+	if encoding := req.Header.Get("Content-Encoding"); encoding != "" {
+		req.Header.Set("Content-Encoding", "aws-chunked,"+encoding)
+	} else {
+		req.Header.Set("Content-Encoding", "aws-chunked")
+	}
+	req.Header.Set("X-Amz-Decoded-Content-Length", strconv.FormatInt(decodedLength, 10))
+	// the transport sends ContentLength, the header is only signed
+	req.Header.Set("Content-Length", strconv.FormatInt(encodedLength, 10))
+	req.ContentLength = encodedLength
+	return nil
+}
+
+// awsChunkedLength returns the encoded length of a body of decodedLength
+// bytes sent in chunks of chunkSize, including the final empty chunk.
+func awsChunkedLength(decodedLength, chunkSize int64) int64 {
+	chunkLength := func(size int64) int64 {
+		// <hex size>;chunk-signature=<64 hex>\r\n<data>\r\n
+		return int64(len(strconv.FormatInt(size, 16))) + int64(len(";chunk-signature=")) + 64 + 2 + size + 2
+	}
+	full := decodedLength / chunkSize
+	length := full * chunkLength(chunkSize)
+	if rest := decodedLength % chunkSize; rest > 0 {
+		length += chunkLength(rest)
+	}
+	return length + chunkLength(0)
+}
+
+// awsChunkedReader encodes a body as signed aws-chunked chunks, each signed
+// with the signature of the previous chunk.
+type awsChunkedReader struct {
+	signer    *AWSSigner
+	body      io.ReadCloser
+	amzDate   string
+	scope     string
+	t         time.Time
+	prevSig   string
+	chunkSize int
+
+	buf  bytes.Buffer
+	done bool
+}
+
+func (r *awsChunkedReader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		chunk := make([]byte, r.chunkSize)
+		n, err := io.ReadFull(r.body, chunk)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		r.writeChunk(chunk[:n])
+		if n == 0 {
+			r.done = true
+		}
+	}
+	return r.buf.Read(p)
+}
+
+func (r *awsChunkedReader) writeChunk(chunk []byte) {
+	sum := sha256.Sum256(chunk)
+	stringToSign := strings.Join([]string{
+		awsChunkAlgorithm,
+		r.amzDate,
+		r.scope,
+		r.prevSig,
+		awsEmptySHA256,
+		hex.EncodeToString(sum[:]),
+	}, "\n")
+	r.prevSig = r.signer.signature(r.t, stringToSign)
+	fmt.Fprintf(&r.buf, "%x;chunk-signature=%s\r\n", len(chunk), r.prevSig)
+	r.buf.Write(chunk)
+	r.buf.WriteString("\r\n")
+}
+
+func (r *awsChunkedReader) Close() error {
+	return r.body.Close()
+}
+
+// canonicalURI returns the URI-encoded path. Except for S3, the path is
+// normalized and each segment is encoded twice.
+func (a *AWSSigner) canonicalURI(u *url.URL) string {
+	p := u.Path
+	if p == "" {
+		return "/"
+	}
+	if a.Service == "s3" {
+		return awsEscapePath(p)
+	}
+	cleaned := path.Clean(p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return awsEscapePath(awsEscapePath(cleaned))
+}
+
+// awsCanonicalHeaders returns the signed header names and the canonical
+// headers block, including the host. Headers which proxies commonly change
+// are not signed.
+func awsCanonicalHeaders(req *http.Request) (string, string) {
+	headers := map[string][]string{}
+	for key, values := range req.Header {
+		lower := strings.ToLower(key)
+		switch lower {
+		case "authorization", "user-agent", "x-amzn-trace-id", "expect":
+			continue
+		}
+		headers[lower] = append(headers[lower], values...)
+	}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers["host"] = []string{host}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	for _, name := range names {
+		values := make([]string, len(headers[name]))
+		for i, value := range headers[name] {
+			values[i] = strings.Join(strings.Fields(value), " ")
+		}
+		canonical.WriteString(name + ":" + strings.Join(values, ",") + "\n")
+	}
+	return strings.Join(names, ";"), canonical.String()
+}
+
+// awsCanonicalQuery re-encodes the raw query with AWS URI encoding, sorted
+// by key and then value.
+func awsCanonicalQuery(rawQuery string) string {
+	type param struct{ key, value string }
+	var params []param
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		key, value := pair, ""
+		if eq := strings.IndexByte(pair, '='); eq >= 0 {
+			key, value = pair[:eq], pair[eq+1:]
+		}
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		if v, err := url.QueryUnescape(value); err == nil {
+			value = v
+		}
+		params = append(params, param{escapeUnreserved(key), escapeUnreserved(value)})
+	}
+	sort.Slice(params, func(i, j int) bool {
+		if params[i].key != params[j].key {
+			return params[i].key < params[j].key
+		}
+		return params[i].value < params[j].value
+	})
+	pairs := make([]string, len(params))
+	for i, p := range params {
+		pairs[i] = p.key + "=" + p.value
+	}
+	return strings.Join(pairs, "&")
+}
+
+// awsEncodeQuery encodes values with AWS URI encoding, sorted by key.
+func awsEncodeQuery(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, key := range keys {
+		for _, value := range values[key] {
+			pairs = append(pairs, escapeUnreserved(key)+"="+escapeUnreserved(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func awsStringToSign(amzDate, scope, canonicalRequest string) string {
+	sum := sha256.Sum256([]byte(canonicalRequest))
+	return strings.Join([]string{awsAlgorithm, amzDate, scope, hex.EncodeToString(sum[:])}, "\n")
+}
+
+// awsEscapePath escapes each segment of the path, keeping the slashes.
+func awsEscapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = escapeUnreserved(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
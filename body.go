@@ -31,6 +31,20 @@ func (p bodyProvider) Body() (io.Reader, error) {
 	return p.body, nil
 }
 
+// bytesBodyProvider provides a new reader over the wrapped bytes as a Body
+// for each request, so the body can be sent more than once.
+type bytesBodyProvider struct {
+	body []byte
+}
+
+func (p bytesBodyProvider) ContentType() string {
+	return ""
+}
+
+func (p bytesBodyProvider) Body() (io.Reader, error) {
+	return bytes.NewReader(p.body), nil
+}
+
 // jsonBodyProvider encodes a JSON tagged struct value as a Body for requests.
 // See https://golang.org/pkg/encoding/json/#MarshalIndent for details.
 type jsonBodyProvider struct {
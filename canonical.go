@@ -0,0 +1,134 @@
+package sling
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Canonical builds a new http.Request from the Sling properties and renders
+// it with CanonicalRequest. Returns any errors building the request or
+// reading its body.
+func (s *Sling) Canonical() ([]byte, error) {
+	req, err := s.request()
+	if err != nil {
+		return nil, err
+	}
+	return CanonicalRequest(req)
+}
+
+// CanonicalRequest renders the request in a stable text form suitable for
+// golden file comparisons. The method and URL (without query) come first,
+// followed by the decoded query parameters and the headers, both sorted by
+// key, and finally the body. JSON bodies are pretty printed and form bodies
+// are decoded into sorted key/value lines.
+//
+// The request body is read and replaced so the request can still be sent.
+func CanonicalRequest(req *http.Request) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	u := *req.URL
+	u.RawQuery = ""
+	u.Fragment = ""
+	fmt.Fprintf(buf, "%s %s\n", req.Method, u.String())
+
+	query, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return nil, err
+	}
+	if len(query) > 0 {
+		buf.WriteString("\nQuery:\n")
+		writeValues(buf, query)
+	}
+
+	if len(req.Header) > 0 {
+		buf.WriteString("\nHeaders:\n")
+		keys := make([]string, 0, len(req.Header))
+		for key := range req.Header {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			for _, value := range req.Header[key] {
+				fmt.Fprintf(buf, "  %s: %s\n", key, value)
+			}
+		}
+	}
+
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > 0 {
+		buf.WriteString("\nBody:\n")
+		buf.Write(canonicalBody(req.Header.Get(contentType), body))
+		if body[len(body)-1] != '\n' {
+			buf.WriteByte('\n')
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeValues writes url.Values as sorted "key=value" lines. Values for a
+// key keep the order in which they were added.
+func writeValues(buf *bytes.Buffer, values url.Values) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range values[key] {
+			fmt.Fprintf(buf, "  %s=%s\n", key, value)
+		}
+	}
+}
+
+// canonicalBody pretty prints bodies with a JSON media type and decodes form
+// bodies. Other bodies, and bodies which fail to parse, are returned
+// unchanged.
+func canonicalBody(ct string, body []byte) []byte {
+	mediaType, _, _ := mime.ParseMediaType(ct)
+	switch {
+	case mediaType == formContentType:
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return body
+		}
+		buf := &bytes.Buffer{}
+		writeValues(buf, values)
+		return buf.Bytes()
+	case mediaType == jsonContentType || strings.HasSuffix(mediaType, "+json"):
+		buf := &bytes.Buffer{}
+		if err := json.Indent(buf, body, "", "  "); err != nil {
+			return body
+		}
+		return buf.Bytes()
+	}
+	return body
+}
+
+// readRequestBody reads all of the request body and replaces it so the
+// request may still be sent. A nil body reads as empty.
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return body, nil
+}
@@ -0,0 +1,24 @@
+package sling
+
+import "testing"
+
+func TestCanonicalBody(t *testing.T) {
+	cases := []struct {
+		contentType string
+		body        string
+		expected    string
+	}{
+		{jsonContentType, `{"a":1}`, "{\n  \"a\": 1\n}"},
+		{"application/problem+json; charset=utf-8", `[1,2]`, "[\n  1,\n  2\n]"},
+		{formContentType, "b=2&a=1", "  a=1\n  b=2\n"},
+		{"text/plain", "true", "true"},
+		{"text/plain", `{"a":1}`, `{"a":1}`},
+		{"", "1", "1"},
+		{jsonContentType, "not json", "not json"},
+	}
+	for _, c := range cases {
+		if got := string(canonicalBody(c.contentType, []byte(c.body))); got != c.expected {
+			t.Errorf("%s %q: expected %q, got %q", c.contentType, c.body, c.expected, got)
+		}
+	}
+}
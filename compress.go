@@ -0,0 +1,150 @@
+package sling
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Content-Encodings of compressed bodies.
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+)
+
+// Compression sets how CompressBody compresses request bodies.
+type Compression struct {
+	// Encoding is EncodingGzip, the default, or EncodingDeflate (zlib).
+	Encoding string
+	// Level is a compress/flate level from flate.HuffmanOnly to
+	// flate.BestCompression. Zero uses flate.DefaultCompression.
+	Level int
+	// MinSize is the size in bytes below which bodies are sent
+	// uncompressed, since compressing them gains little.
+	MinSize int
+}
+
+// CompressBody returns a BodyProvider which compresses the body of another
+// provider and sets the Content-Encoding header of requests. Bodies are
+// compressed as they are sent rather than buffered, so their length isn't
+// known up front. Unless the provider wraps a single reader, as Body does,
+// the body is compressed again when a request is retried or redirected.
+// Requests which already set a Content-Encoding header are sent
+// uncompressed.
+func CompressBody(body BodyProvider, compression Compression) BodyProvider {
+	return compressBodyProvider{body: body, compression: compression}
+}
+
+// Compress compresses the Sling's current body. Set the body first, for
+// example
+//
+//	s.BodyJSON(batch).Compress(sling.Compression{MinSize: 1024})
+func (s *Sling) Compress(compression Compression) *Sling {
+	if s.bodyProvider == nil {
+		return s
+	}
+	return s.BodyProvider(CompressBody(s.bodyProvider, compression))
+}
+
+// contentEncoder is implemented by bodies which set the Content-Encoding of
+// requests.
+type contentEncoder interface {
+	ContentEncoding() string
+}
+
+// compressBodyProvider compresses the body of another provider.
+type compressBodyProvider struct {
+	body        BodyProvider
+	compression Compression
+}
+
+// replayable reports whether the provider gives a fresh body each time, so
+// it can be compressed again to send a request more than once.
+func (p compressBodyProvider) replayable() bool {
+	_, oneReader := p.body.(bodyProvider)
+	return !oneReader
+}
+
+func (p compressBodyProvider) ContentType() string {
+	return p.body.ContentType()
+}
+
+func (p compressBodyProvider) Body() (io.Reader, error) {
+	body, err := p.body.Body()
+	if err != nil || body == nil {
+		return body, err
+	}
+	if min := p.compression.MinSize; min > 0 {
+		// small bodies are sent as they are
+		prefix := make([]byte, min)
+		n, err := io.ReadFull(body, prefix)
+		switch {
+		case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+			return bytes.NewReader(prefix[:n]), nil
+		case err != nil:
+			return nil, err
+		}
+		body = io.MultiReader(bytes.NewReader(prefix), body)
+	}
+
+	reader := &compressReader{src: body, encoding: p.compression.Encoding, chunk: make([]byte, 32<<10)}
+	level := p.compression.Level
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+	switch reader.encoding {
+	case "", EncodingGzip:
+		reader.encoding = EncodingGzip
+		reader.zw, err = gzip.NewWriterLevel(&reader.buf, level)
+	case EncodingDeflate:
+		reader.zw, err = zlib.NewWriterLevel(&reader.buf, level)
+	default:
+		return nil, fmt.Errorf("sling: unsupported body encoding %q", reader.encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+// compressReader compresses src as it is read, holding only what the
+// compressor has flushed but hasn't been read.
+type compressReader struct {
+	src      io.Reader
+	zw       io.WriteCloser
+	buf      bytes.Buffer
+	chunk    []byte
+	encoding string
+	done     bool
+}
+
+func (r *compressReader) ContentEncoding() string {
+	return r.encoding
+}
+
+func (r *compressReader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 && !r.done {
+		n, err := r.src.Read(r.chunk)
+		if n > 0 {
+			if _, err := r.zw.Write(r.chunk[:n]); err != nil {
+				return 0, err
+			}
+		}
+		if err == io.EOF {
+			if err := r.zw.Close(); err != nil {
+				return 0, err
+			}
+			r.done = true
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	if r.buf.Len() == 0 {
+		return 0, io.EOF
+	}
+	return r.buf.Read(p)
+}
@@ -0,0 +1,173 @@
+package sling
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressBody(t *testing.T) {
+	var encoding string
+	var received []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		var body io.Reader = r.Body
+		var err error
+		switch encoding {
+		case EncodingGzip:
+			body, err = gzip.NewReader(r.Body)
+		case EncodingDeflate:
+			body, err = zlib.NewReader(r.Body)
+		}
+		if err == nil {
+			received, err = io.ReadAll(body)
+		}
+		if err != nil {
+			t.Errorf("could not read body: %v", err)
+		}
+		w.WriteHeader(204)
+	}))
+	defer server.Close()
+
+	batch := []*FakeModel{}
+	for i := 0; i < 100; i++ {
+		batch = append(batch, &FakeModel{Text: "Some text", FavoriteCount: int64(i)})
+	}
+	expected, _ := jsonBodyProvider{batch}.Body()
+	expectedBody, _ := io.ReadAll(expected)
+
+	cases := []struct {
+		compression Compression
+		encoding    string
+	}{
+		{Compression{}, EncodingGzip},
+		{Compression{Encoding: EncodingDeflate}, EncodingDeflate},
+		{Compression{Level: flate.BestCompression}, EncodingGzip},
+		{Compression{Level: flate.HuffmanOnly, MinSize: 1024}, EncodingGzip},
+		{Compression{MinSize: len(expectedBody)}, EncodingGzip},
+		{Compression{MinSize: len(expectedBody) + 1}, ""},
+	}
+	for _, c := range cases {
+		_, err := New().Base(server.URL).Post("").BodyJSON(batch).Compress(c.compression).ReceiveSuccess(new(FakeModel))
+		if err != nil {
+			t.Errorf("expected nil, got %v", err)
+		}
+		if encoding != c.encoding {
+			t.Errorf("expected Content-Encoding %q, got %q", c.encoding, encoding)
+		}
+		if !bytes.Equal(received, expectedBody) {
+			t.Errorf("expected body %s, got %s", expectedBody, received)
+		}
+	}
+
+	req, err := New().Post("http://example.com").BodyJSON(batch).Compress(Compression{}).request()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if req.Header.Get(contentType) != jsonContentType || req.ContentLength != 0 {
+		t.Errorf("expected a streamed JSON body, got %v", req.Header)
+	}
+
+	_, err = New().Post("http://example.com").BodyJSON(batch).Compress(Compression{Encoding: "br"}).request()
+	if err == nil || !strings.Contains(err.Error(), `unsupported body encoding "br"`) {
+		t.Errorf("expected unsupported encoding error, got %v", err)
+	}
+}
+
+// countingReader counts the bytes read from it.
+type countingReader struct {
+	r    io.Reader
+	read int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+	return n, err
+}
+
+func TestCompressBody_replay(t *testing.T) {
+	var received []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusTemporaryRedirect)
+			return
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err == nil {
+			received, err = io.ReadAll(zr)
+		}
+		if err != nil {
+			t.Errorf("could not read body: %v", err)
+		}
+		w.WriteHeader(204)
+	}))
+	defer server.Close()
+
+	// the body is compressed again to follow the redirect
+	model := &FakeModel{Text: "Some text"}
+	expected, _ := jsonBodyProvider{model}.Body()
+	expectedBody, _ := io.ReadAll(expected)
+	if _, err := New().Post(server.URL + "/old").BodyJSON(model).Compress(Compression{}).ReceiveSuccess(new(FakeModel)); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if !bytes.Equal(received, expectedBody) {
+		t.Errorf("expected body %s, got %s", expectedBody, received)
+	}
+
+	// a body wrapping a single reader can't be compressed again
+	req, err := New().Post(server.URL).Body(strings.NewReader("text")).Compress(Compression{}).request()
+	if err != nil || req.GetBody != nil {
+		t.Errorf("expected a body which can't be replayed, got %v", err)
+	}
+}
+
+func TestCompressBody_encodingSet(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte("text"))
+	zw.Close()
+
+	// a body the caller encoded isn't compressed again
+	req, err := New().Post("http://example.com").Set("Content-Encoding", EncodingGzip).Body(bytes.NewReader(compressed.Bytes())).Compress(Compression{}).request()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	sent, _ := io.ReadAll(req.Body)
+	if req.Header.Get("Content-Encoding") != EncodingGzip || !bytes.Equal(sent, compressed.Bytes()) {
+		t.Errorf("expected the caller's encoded body, got %q %q", req.Header.Get("Content-Encoding"), sent)
+	}
+}
+
+func TestCompressBody_streams(t *testing.T) {
+	random := make([]byte, 1<<20)
+	rand.Read(random)
+	src := &countingReader{r: bytes.NewReader(random)}
+	body, err := CompressBody(bodyProvider{src}, Compression{}).Body()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	if _, err := body.Read(make([]byte, 1)); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if src.read >= len(random) {
+		t.Errorf("expected the body to be compressed as it is read, got %d bytes read up front", src.read)
+	}
+
+	zr, err := gzip.NewReader(io.MultiReader(bytes.NewReader([]byte{0x1f}), body))
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	decompressed, err := io.ReadAll(zr)
+	if err != nil || !bytes.Equal(decompressed, random) {
+		t.Errorf("expected the body to decompress, got %d bytes, %v", len(decompressed), err)
+	}
+}
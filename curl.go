@@ -0,0 +1,379 @@
+package sling
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const redacted = "REDACTED"
+
+// Curl builds a new http.Request from the Sling properties and renders it as
+// a shell-safe curl command. Values of the given header names are replaced
+// with "REDACTED", as are values masked by the Sling's RedactionPolicy.
+func (s *Sling) Curl(redactHeaders ...string) (string, error) {
+	req, err := s.request()
+	if err != nil {
+		return "", err
+	}
+	if policy := requestRedaction(req, nil); policy != nil {
+		if req, err = policy.maskRequest(req); err != nil {
+			return "", err
+		}
+	}
+	return CurlCommand(req, redactHeaders...)
+}
+
+// CurlCommand renders the request as a shell-safe curl command. Values of
+// the given header names are replaced with "REDACTED". The request body is
+// read and replaced so the request can still be sent.
+func CurlCommand(req *http.Request, redactHeaders ...string) (string, error) {
+	redact := make(map[string]bool, len(redactHeaders))
+	for _, key := range redactHeaders {
+		redact[http.CanonicalHeaderKey(key)] = true
+	}
+
+	body, err := readRequestBody(req)
+	if err != nil {
+		return "", err
+	}
+
+	parts := []string{"curl"}
+	switch req.Method {
+	case "", "GET":
+	case "HEAD":
+		// -X HEAD would wait for a response body which never comes
+		parts = append(parts, "-I")
+	default:
+		parts = append(parts, "-X", shellQuote(req.Method))
+	}
+	parts = append(parts, shellQuote(req.URL.String()))
+
+	keys := make([]string, 0, len(req.Header))
+	for key := range req.Header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range req.Header[key] {
+			if redact[key] {
+				value = redacted
+			}
+			parts = append(parts, "-H", shellQuote(key+": "+value))
+		}
+	}
+
+	if len(body) > 0 {
+		flag := "--data-binary"
+		if body[0] == '@' {
+			// --data-binary would read the rest of the body as a file name
+			flag = "--data-raw"
+		}
+		parts = append(parts, flag, shellQuote(string(body)))
+	}
+
+	return strings.Join(parts, " "), nil
+}
+
+// shellQuote single quotes s for POSIX shells. Single quotes within s are
+// closed, escaped and reopened.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, needsQuote) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func needsQuote(r rune) bool {
+	switch {
+	case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		return false
+	}
+	return !strings.ContainsRune("-_./:@%+=,", r)
+}
+
+// ParseCurl parses a curl command, such as one copied from browser devtools,
+// into a new Sling with the method, URL, headers and body of the command.
+// Basic auth (-u), user agent (-A), referer (-e), cookies (-b) and -G are
+// supported. Flags which don't change the request, such as --compressed or
+// -s, are ignored. Other flags, and data read from a file with @, return an
+// error.
+func ParseCurl(command string) (*Sling, error) {
+	args, err := shellSplit(command)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 || args[0] != "curl" {
+		return nil, fmt.Errorf("curl: command must start with curl")
+	}
+
+	var (
+		method   string
+		rawURL   string
+		header   = make(http.Header)
+		data     []string
+		getData  bool
+		user     string
+		hasUser  bool
+		hasData  bool
+		headOnly bool
+	)
+
+	args = args[1:]
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			rawURL = arg
+			continue
+		}
+
+		name, value, hasValue := arg, "", false
+		if !strings.HasPrefix(arg, "--") && len(arg) > 2 {
+			// short flags may be combined (-sSL) or have an attached value (-XPOST)
+			if curlShortValueFlags[arg[:2]] {
+				name, value, hasValue = arg[:2], arg[2:], true
+			} else {
+				for _, r := range arg[1:] {
+					if !curlIgnoredFlags["-"+string(r)] {
+						return nil, fmt.Errorf("curl: unsupported flag -%c in %s", r, arg)
+					}
+				}
+				continue
+			}
+		}
+
+		if curlIgnoredFlags[name] {
+			continue
+		}
+		if !hasValue {
+			if !curlValueFlags[name] {
+				switch name {
+				case "-G", "--get":
+					getData = true
+				case "-I", "--head":
+					headOnly = true
+				default:
+					return nil, fmt.Errorf("curl: unsupported flag %s", name)
+				}
+				continue
+			}
+			i++
+			if i >= len(args) {
+				return nil, fmt.Errorf("curl: flag %s requires a value", name)
+			}
+			value = args[i]
+		}
+
+		switch name {
+		case "-X", "--request":
+			method = value
+		case "--url":
+			rawURL = value
+		case "-H", "--header":
+			colon := strings.IndexByte(value, ':')
+			if colon <= 0 {
+				return nil, fmt.Errorf("curl: invalid header %q", value)
+			}
+			header.Add(strings.TrimSpace(value[:colon]), strings.TrimSpace(value[colon+1:]))
+		case "-d", "--data", "--data-binary", "--data-ascii":
+			if strings.HasPrefix(value, "@") {
+				return nil, fmt.Errorf("curl: unsupported %s from a file", name)
+			}
+			hasData = true
+			data = append(data, value)
+		case "--data-raw":
+			hasData = true
+			data = append(data, value)
+		case "--data-urlencode":
+			if at := strings.IndexAny(value, "=@"); at >= 0 && value[at] == '@' {
+				return nil, fmt.Errorf("curl: unsupported %s from a file", name)
+			}
+			hasData = true
+			data = append(data, urlEncodeData(value))
+		case "-u", "--user":
+			user, hasUser = value, true
+		case "-A", "--user-agent":
+			header.Set("User-Agent", value)
+		case "-e", "--referer":
+			header.Set("Referer", value)
+		case "-b", "--cookie":
+			header.Add("Cookie", value)
+		default:
+			return nil, fmt.Errorf("curl: unsupported flag %s", name)
+		}
+	}
+
+	if rawURL == "" {
+		return nil, fmt.Errorf("curl: no URL given")
+	}
+
+	s := New().Base(rawURL).SetHeaders(header)
+	if hasUser {
+		username, password := user, ""
+		if colon := strings.IndexByte(user, ':'); colon >= 0 {
+			username, password = user[:colon], user[colon+1:]
+		}
+		s.SetBasicAuth(username, password)
+	}
+
+	switch {
+	case hasData && getData:
+		values, err := url.ParseQuery(strings.Join(data, "&"))
+		if err != nil {
+			return nil, fmt.Errorf("curl: invalid -G data: %w", err)
+		}
+		s.QueryValues(values)
+	case hasData:
+		s.BodyProvider(bytesBodyProvider{body: []byte(strings.Join(data, "&"))})
+		if s.header.Get(contentType) == "" {
+			s.Set(contentType, formContentType)
+		}
+		if method == "" {
+			method = "POST"
+		}
+	}
+
+	switch {
+	case method != "":
+		s.Method(method)
+	case headOnly:
+		s.Method("HEAD")
+	}
+	return s, nil
+}
+
+// curlValueFlags are the supported curl flags which take a value.
+var curlValueFlags = map[string]bool{
+	"-X": true, "--request": true,
+	"--url": true,
+	"-H":    true, "--header": true,
+	"-d": true, "--data": true, "--data-raw": true, "--data-binary": true, "--data-ascii": true, "--data-urlencode": true,
+	"-u": true, "--user": true,
+	"-A": true, "--user-agent": true,
+	"-e": true, "--referer": true,
+	"-b": true, "--cookie": true,
+}
+
+// curlShortValueFlags are the short flags which may have an attached value.
+var curlShortValueFlags = map[string]bool{
+	"-X": true, "-H": true, "-d": true, "-u": true, "-A": true, "-e": true, "-b": true,
+}
+
+// curlIgnoredFlags don't change the request which is sent.
+var curlIgnoredFlags = map[string]bool{
+	"-s": true, "--silent": true,
+	"-S": true, "--show-error": true,
+	"-v": true, "--verbose": true,
+	"-i": true, "--include": true,
+	"-L": true, "--location": true,
+	"-k": true, "--insecure": true,
+	"-f": true, "--fail": true,
+	"--compressed": true,
+}
+
+// urlEncodeData encodes a --data-urlencode value. A "name=content" value
+// has only its content encoded, otherwise the whole value is encoded.
+func urlEncodeData(value string) string {
+	if eq := strings.IndexByte(value, '='); eq >= 0 {
+		return value[:eq+1] + url.QueryEscape(value[eq+1:])
+	}
+	return url.QueryEscape(value)
+}
+
+// shellSplit splits a command into arguments following POSIX shell quoting
+// rules for single quotes, double quotes, $'...' strings, backslash escapes
+// and line continuations.
+func shellSplit(command string) ([]string, error) {
+	var (
+		args    []string
+		current bytes.Buffer
+		inArg   bool
+	)
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case c == '\\':
+			i++
+			if i >= len(command) {
+				return nil, fmt.Errorf("curl: trailing backslash")
+			}
+			if command[i] == '\n' {
+				continue
+			}
+			current.WriteByte(command[i])
+			inArg = true
+		case c == '\'':
+			end := strings.IndexByte(command[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("curl: unterminated single quote")
+			}
+			current.WriteString(command[i+1 : i+1+end])
+			i += end + 1
+			inArg = true
+		case c == '$' && i+1 < len(command) && command[i+1] == '\'':
+			n, err := ansiCString(command[i+2:], &current)
+			if err != nil {
+				return nil, err
+			}
+			i += n + 2
+			inArg = true
+		case c == '"':
+			i++
+			for ; i < len(command) && command[i] != '"'; i++ {
+				if command[i] == '\\' && i+1 < len(command) && strings.IndexByte("$`\"\\\n", command[i+1]) >= 0 {
+					i++
+					if command[i] == '\n' {
+						continue
+					}
+				}
+				current.WriteByte(command[i])
+			}
+			if i >= len(command) {
+				return nil, fmt.Errorf("curl: unterminated double quote")
+			}
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteByte(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// ansiCString decodes the body of a $'...' string up to and including the
+// closing quote into buf, returning the number of bytes consumed.
+func ansiCString(s string, buf *bytes.Buffer) (int, error) {
+	escapes := map[byte]byte{'n': '\n', 't': '\t', 'r': '\r', '\\': '\\', '\'': '\'', '"': '"'}
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\'':
+			return i + 1, nil
+		case '\\':
+			i++
+			if i >= len(s) {
+				break
+			}
+			if c, ok := escapes[s[i]]; ok {
+				buf.WriteByte(c)
+			} else {
+				buf.WriteByte('\\')
+				buf.WriteByte(s[i])
+			}
+		default:
+			buf.WriteByte(s[i])
+		}
+	}
+	return 0, fmt.Errorf("curl: unterminated $' quote")
+}
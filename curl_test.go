@@ -0,0 +1,133 @@
+package sling
+
+import (
+	"io"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCurl(t *testing.T) {
+	cases := []struct {
+		sling    *Sling
+		redact   []string
+		expected string
+	}{
+		{New().Get("https://a.io/foo").QueryStruct(paramsB), nil, "curl 'https://a.io/foo?count=25&kind_name=recent'"},
+		{New().Post("https://a.io/foo").BodyJSON(modelA), nil, `curl -X POST https://a.io/foo -H 'Content-Type: application/json' --data-binary '{"text":"note","favorite_count":12}` + "\n'"},
+		{New().Get("https://a.io/").SetBasicAuth("user", "pass"), []string{"authorization"}, "curl https://a.io/ -H 'Authorization: REDACTED'"},
+		{New().Put("https://a.io/").Set("X-Quote", "it's"), nil, `curl -X PUT https://a.io/ -H 'X-Quote: it'\''s'`},
+		{New().Head("https://a.io/"), nil, "curl -I https://a.io/"},
+		{New().Post("https://a.io/").Body(strings.NewReader("@file")), nil, "curl -X POST https://a.io/ --data-raw @file"},
+	}
+	for _, c := range cases {
+		command, err := c.sling.Curl(c.redact...)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if command != c.expected {
+			t.Errorf("expected %s, got %s", c.expected, command)
+		}
+	}
+}
+
+func TestParseCurl(t *testing.T) {
+	cases := []struct {
+		command        string
+		expectedMethod string
+		expectedURL    string
+		expectedHeader map[string][]string
+		expectedBody   string
+	}{
+		{"curl https://a.io/foo", "GET", "https://a.io/foo", map[string][]string{}, ""},
+		{
+			`curl 'https://a.io/foo' -H 'Accept: application/json' \
+  -H "X-Name: \"quoted\"" --compressed -sSL`,
+			"GET", "https://a.io/foo",
+			map[string][]string{"Accept": {"application/json"}, "X-Name": {`"quoted"`}},
+			"",
+		},
+		{
+			`curl -XPUT https://a.io/foo -H 'Content-Type: application/json' --data-raw $'{"text":"it\'s"}'`,
+			"PUT", "https://a.io/foo",
+			map[string][]string{"Content-Type": {"application/json"}},
+			`{"text":"it's"}`,
+		},
+		{
+			"curl https://a.io/foo -d a=1 --data-urlencode 'b=c d' -u user:pass",
+			"POST", "https://a.io/foo",
+			map[string][]string{"Content-Type": {formContentType}, "Authorization": {"Basic dXNlcjpwYXNz"}},
+			"a=1&b=c+d",
+		},
+		{"curl -G https://a.io/foo -d a=1 -d b=2", "GET", "https://a.io/foo?a=1&b=2", map[string][]string{}, ""},
+		{"curl -I https://a.io/foo", "HEAD", "https://a.io/foo", map[string][]string{}, ""},
+		{"curl https://a.io/foo --data-raw @file --data-urlencode 'a=b@c'", "POST", "https://a.io/foo", map[string][]string{"Content-Type": {formContentType}}, "@file&a=b%40c"},
+	}
+	for _, c := range cases {
+		s, err := ParseCurl(c.command)
+		if err != nil {
+			t.Errorf("unexpected error parsing %s: %v", c.command, err)
+			continue
+		}
+		req, err := s.request()
+		if err != nil {
+			t.Errorf("unexpected error building request: %v", err)
+			continue
+		}
+		if req.Method != c.expectedMethod {
+			t.Errorf("expected method %s, got %s", c.expectedMethod, req.Method)
+		}
+		if req.URL.String() != c.expectedURL {
+			t.Errorf("expected url %s, got %s", c.expectedURL, req.URL)
+		}
+		if !reflect.DeepEqual(c.expectedHeader, map[string][]string(req.Header)) {
+			t.Errorf("not DeepEqual: expected %v, got %v", c.expectedHeader, req.Header)
+		}
+		var body string
+		if req.Body != nil {
+			b, _ := io.ReadAll(req.Body)
+			body = string(b)
+		}
+		if body != c.expectedBody {
+			t.Errorf("expected body %s, got %s", c.expectedBody, body)
+		}
+	}
+}
+
+func TestParseCurl_errors(t *testing.T) {
+	cases := []string{
+		"wget https://a.io/",
+		"curl",
+		"curl 'https://a.io/",
+		"curl https://a.io/ -H",
+		"curl https://a.io/ --upload-file x",
+		"curl https://a.io/ -sZ",
+		"curl https://a.io/ -d @body.json",
+		"curl https://a.io/ --data-binary @body.json",
+		"curl https://a.io/ --data-urlencode name@body.txt",
+		"curl https://a.io/ --header=Accept:text/plain",
+	}
+	for _, command := range cases {
+		if _, err := ParseCurl(command); err == nil {
+			t.Errorf("expected error parsing %s", command)
+		}
+	}
+}
+
+func TestCurl_roundTrip(t *testing.T) {
+	original := New().Post("https://a.io/foo").QueryValues(url.Values{"q": {"a b"}}).Set("X-Quote", "it's").BodyForm(paramsB)
+	command, err := original.Curl()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parsed, err := ParseCurl(command)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected, _ := original.Canonical()
+	got, _ := parsed.Canonical()
+	if string(expected) != string(got) {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
@@ -0,0 +1,161 @@
+package sling
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Digest algorithms of the Content-Digest and Repr-Digest fields (RFC 9530).
+const (
+	DigestSHA256 = "sha-256"
+	DigestSHA512 = "sha-512"
+)
+
+// DigestError is returned when a response body does not match its
+// Content-Digest or Repr-Digest.
+type DigestError struct {
+	// Header is "Content-Digest" or "Repr-Digest".
+	Header    string
+	Algorithm string
+	Expected  []byte
+	Actual    []byte
+}
+
+func (e *DigestError) Error() string {
+	return fmt.Sprintf("digest: %s %s mismatch: expected %s, got %s", e.Header, e.Algorithm,
+		base64.StdEncoding.EncodeToString(e.Expected), base64.StdEncoding.EncodeToString(e.Actual))
+}
+
+// ContentDigest sets the Content-Digest header of requests to the digests of
+// the body with the given algorithms, by default sha-256. The digest is
+// computed when the request is built, before any Signer runs, so it can be
+// covered by a request signature.
+func (s *Sling) ContentDigest(algorithms ...string) *Sling {
+	if len(algorithms) == 0 {
+		algorithms = []string{DigestSHA256}
+	}
+	s.contentDigests = algorithms
+	return s
+}
+
+// VerifyDigest sets whether Receive verifies the Content-Digest and
+// Repr-Digest headers of responses, as the body is decoded. The body is read
+// to the end and a mismatch is returned as a *DigestError. Responses without
+// digest headers, or with only unsupported algorithms, are not checked.
+//
+// Both digests are computed over the bytes as sent, including any
+// Content-Encoding, so neither is checked when the body was decompressed by
+// the Transport or under MaxResponseSize. Repr-Digest covers the whole
+// representation, so it is not checked for 206 (partial content) responses.
+func (s *Sling) VerifyDigest(verify bool) *Sling {
+	s.verifyDigests = verify
+	return s
+}
+
+// digestHash returns a new hash for the digest algorithm, or nil if it is not
+// supported.
+func digestHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case DigestSHA256:
+		return sha256.New()
+	case DigestSHA512:
+		return sha512.New()
+	}
+	return nil
+}
+
+// setContentDigest sets the Content-Digest header of the request.
+func setContentDigest(req *http.Request, algorithms []string) error {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return err
+	}
+	members := make([]string, len(algorithms))
+	for i, algorithm := range algorithms {
+		h := digestHash(algorithm)
+		if h == nil {
+			return fmt.Errorf("digest: unsupported algorithm %q", algorithm)
+		}
+		h.Write(body)
+		members[i] = algorithm + "=:" + base64.StdEncoding.EncodeToString(h.Sum(nil)) + ":"
+	}
+	req.Header.Set("Content-Digest", strings.Join(members, ", "))
+	return nil
+}
+
+// digestReader hashes a response body as it is read.
+type digestReader struct {
+	io.Reader
+	checks []digestCheck
+}
+
+// digestCheck is a digest of the body to verify.
+type digestCheck struct {
+	header    string
+	algorithm string
+	expected  []byte
+	hash      hash.Hash
+}
+
+// newDigestReader replaces the response body with a digestReader which
+// checks the response's digest headers. It returns nil if there is nothing
+// to check.
+func newDigestReader(resp *http.Response) (*digestReader, error) {
+	var checks []digestCheck
+	if resp.Uncompressed {
+		// the digests are of the compressed bytes
+		return nil, nil
+	}
+	for _, header := range []string{"Content-Digest", "Repr-Digest"} {
+		if header == "Repr-Digest" && resp.StatusCode == http.StatusPartialContent {
+			continue
+		}
+		values := resp.Header.Values(header)
+		if len(values) == 0 {
+			continue
+		}
+		digests, err := parseByteSequences(values)
+		if err != nil {
+			return nil, fmt.Errorf("digest: invalid %s header: %w", header, err)
+		}
+		// check the strongest supported algorithm
+		for _, algorithm := range []string{DigestSHA512, DigestSHA256} {
+			if expected, ok := digests[algorithm]; ok {
+				checks = append(checks, digestCheck{header, algorithm, expected, digestHash(algorithm)})
+				break
+			}
+		}
+	}
+	if len(checks) == 0 {
+		return nil, nil
+	}
+
+	writers := make([]io.Writer, len(checks))
+	for i, check := range checks {
+		writers[i] = check.hash
+	}
+	r := &digestReader{io.TeeReader(resp.Body, io.MultiWriter(writers...)), checks}
+	resp.Body = &readAndClose{r, resp.Body}
+	return r, nil
+}
+
+// verify reads the rest of the body and compares the digests.
+func (r *digestReader) verify() error {
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return err
+	}
+	for _, check := range r.checks {
+		actual := check.hash.Sum(nil)
+		if subtle.ConstantTimeCompare(actual, check.expected) != 1 {
+			return &DigestError{Header: check.header, Algorithm: check.algorithm, Expected: check.expected, Actual: actual}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package sling
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestContentDigest(t *testing.T) {
+	// examples from RFC 9530
+	body := `{"hello": "world"}`
+	cases := []struct {
+		algorithms []string
+		expected   string
+	}{
+		{nil, "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:"},
+		{[]string{DigestSHA512}, "sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:"},
+		{[]string{DigestSHA256, DigestSHA512}, "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:, sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:"},
+	}
+	for _, c := range cases {
+		req, err := New().Post("https://example.com/").Body(strings.NewReader(body)).ContentDigest(c.algorithms...).request()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := req.Header.Get("Content-Digest"); got != c.expected {
+			t.Errorf("expected Content-Digest %s, got %s", c.expected, got)
+		}
+		sent, _ := io.ReadAll(req.Body)
+		if string(sent) != body {
+			t.Errorf("expected body %s to be sent, got %s", body, sent)
+		}
+	}
+
+	_, err := New().Post("https://example.com/").BodyJSON(body).ContentDigest("md5").request()
+	if err == nil || !strings.Contains(err.Error(), `unsupported algorithm "md5"`) {
+		t.Errorf("expected unsupported algorithm error, got %v", err)
+	}
+}
+
+func TestContentDigest_signed(t *testing.T) {
+	secret := []byte("secret")
+	var verifyErr error
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verifier := &MessageVerifier{Keys: map[string]VerificationKey{"k": {Algorithm: SignatureHMACSHA256, Key: secret}}, Required: []string{"content-digest"}}
+		verifyErr = verifier.VerifyRequest(r)
+	}))
+	defer server.Close()
+
+	signer := &MessageSigner{Components: []string{"@method", "content-digest"}, KeyID: "k", Algorithm: SignatureHMACSHA256, Key: secret}
+	_, err := New().Post(server.URL).BodyJSON(map[string]string{"a": "b"}).ContentDigest().Signer(signer).ReceiveSuccess(new(FakeModel))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verifyErr != nil {
+		t.Errorf("expected the signature covering Content-Digest to verify, got %v", verifyErr)
+	}
+}
+
+func TestVerifyDigest(t *testing.T) {
+	const (
+		body   = `{"hello": "world"}`
+		sha256 = "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:"
+		sha512 = "sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:"
+		wrong  = "sha-256=:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=:"
+	)
+	cases := []struct {
+		header   string
+		value    string
+		status   int
+		mismatch string
+	}{
+		{"Content-Digest", sha256, 200, ""},
+		{"Content-Digest", sha512, 200, ""},
+		{"Repr-Digest", sha256 + ", " + sha512, 200, ""},
+		{"Content-Digest", "md5=:AAAA:", 200, ""},
+		{"Content-Digest", wrong, 200, "Content-Digest"},
+		{"Repr-Digest", wrong, 200, "Repr-Digest"},
+		{"Content-Digest", wrong, 400, "Content-Digest"},
+		// the strongest algorithm is checked
+		{"Content-Digest", wrong + ", " + sha512, 200, ""},
+	}
+	for _, c := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", jsonContentType)
+			w.Header().Set(c.header, c.value)
+			w.WriteHeader(c.status)
+			fmt.Fprint(w, body)
+		}))
+
+		_, err := New().Get(server.URL).VerifyDigest(true).Receive(new(map[string]string), new(map[string]string))
+		var digestErr *DigestError
+		if c.mismatch == "" && err != nil {
+			t.Errorf("%s %s: expected digest to verify, got %v", c.header, c.value, err)
+		}
+		if c.mismatch != "" && (!errors.As(err, &digestErr) || digestErr.Header != c.mismatch) {
+			t.Errorf("%s %s: expected a %s *DigestError, got %v", c.header, c.value, c.mismatch, err)
+		}
+
+		// digests are not verified by default
+		if _, err := New().Get(server.URL).Receive(new(map[string]string), new(map[string]string)); err != nil {
+			t.Errorf("expected digest not to be verified, got %v", err)
+		}
+		server.Close()
+	}
+}
+
+func TestVerifyDigest_representation(t *testing.T) {
+	const body = `{"hello": "world"}`
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte(body))
+	zw.Close()
+	reprDigest := func(b []byte) string {
+		sum := sha256.Sum256(b)
+		return "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+	}
+
+	// Repr-Digest covers the gzip bytes, which the body no longer is once decompressed
+	gzipServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", jsonContentType)
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Repr-Digest", reprDigest(compressed.Bytes()))
+		w.Write(compressed.Bytes())
+	}))
+	defer gzipServer.Close()
+	for _, s := range []*Sling{New(), New().MaxResponseSize(1 << 20)} {
+		var got map[string]string
+		if _, err := s.Get(gzipServer.URL).VerifyDigest(true).ReceiveSuccess(&got); err != nil {
+			t.Errorf("expected Repr-Digest of a decompressed body not to be checked, got %v", err)
+		}
+		if got["hello"] != "world" {
+			t.Errorf("expected body to be decoded, got %v", got)
+		}
+	}
+
+	// Repr-Digest covers the whole representation, not the range sent
+	partialServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", jsonContentType)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(body)-1, len(body)+10))
+		w.Header().Set("Repr-Digest", reprDigest([]byte(body+`          `)))
+		w.Header().Set("Content-Digest", r.Header.Get("X-Content-Digest"))
+		w.WriteHeader(http.StatusPartialContent)
+		fmt.Fprint(w, body)
+	}))
+	defer partialServer.Close()
+	partial := New().Get(partialServer.URL).VerifyDigest(true)
+	if _, err := partial.New().ReceiveSuccess(new(map[string]string)); err != nil {
+		t.Errorf("expected Repr-Digest of a partial response not to be checked, got %v", err)
+	}
+	// Content-Digest of a partial response is still checked
+	wrong := "sha-256=:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=:"
+	_, err := partial.New().Set("X-Content-Digest", wrong).ReceiveSuccess(new(map[string]string))
+	var digestErr *DigestError
+	if !errors.As(err, &digestErr) || digestErr.Header != "Content-Digest" {
+		t.Errorf("expected a Content-Digest *DigestError, got %v", err)
+	}
+}
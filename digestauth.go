@@ -0,0 +1,254 @@
+package sling
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// SetDigestAuth sets the Sling to authorize requests with HTTP Digest
+// Authentication (RFC 7616) using the provided username and password.
+//
+// The first request is sent without credentials. When it is rejected with a
+// 401 Unauthorized Digest challenge, the request is sent once more with an
+// Authorization header. The challenge is cached, and shared with children
+// created with New(), so later requests are authorized up front with an
+// incremented nonce count. SHA-256 and MD5 (and their -sess variants) are
+// supported, with qop "auth" preferred over "auth-int".
+//
+// Request bodies which can't be replayed, such as those set with Body, are
+// buffered in memory so the request can be sent again after the challenge.
+func (s *Sling) SetDigestAuth(username, password string) *Sling {
+	s.auth = &digestAuth{username: username, password: password, cnonce: randomID}
+	return s
+}
+
+// digestAuth authorizes requests with HTTP Digest Authentication.
+type digestAuth struct {
+	username, password string
+	// cnonce returns client nonces, randomID unless a test sets another
+	cnonce func() (string, error)
+
+	mu        sync.Mutex
+	challenge *digestChallenge
+	nc        int
+}
+
+// digestChallenge is a Digest WWW-Authenticate challenge.
+type digestChallenge struct {
+	realm, nonce, opaque, algorithm, qop string
+}
+
+func (a *digestAuth) authorize(req *http.Request) (*http.Request, error) {
+	a.mu.Lock()
+	challenge := a.challenge
+	if challenge != nil {
+		a.nc++
+	}
+	nc := a.nc
+	a.mu.Unlock()
+
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		if _, err := readRequestBody(req); err != nil {
+			return nil, err
+		}
+	}
+	if challenge == nil {
+		return req, nil
+	}
+	authorization, err := a.authorization(req, challenge, nc)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", authorization)
+	return req, nil
+}
+
+func (a *digestAuth) retry(req *http.Request, resp *http.Response) (bool, error) {
+	if resp.StatusCode != http.StatusUnauthorized {
+		return false, nil
+	}
+	challenge, stale := parseDigestChallenge(resp.Header.Values("WWW-Authenticate"))
+	if challenge == nil {
+		return false, nil
+	}
+
+	// the credentials were rejected, unless the nonce was stale or old
+	if !stale {
+		for _, sent := range parseChallenges(req.Header.Values("Authorization")) {
+			if sent.params["nonce"] == challenge.nonce {
+				return false, nil
+			}
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.challenge = challenge
+	a.nc = 0
+	return true, nil
+}
+
+// authorization returns the Authorization header value for the request.
+func (a *digestAuth) authorization(req *http.Request, c *digestChallenge, nc int) (string, error) {
+	algorithm := strings.ToUpper(c.algorithm)
+	var newHash func() hash.Hash
+	switch strings.TrimSuffix(algorithm, "-SESS") {
+	case "", "MD5":
+		newHash = md5.New
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		return "", fmt.Errorf("digest auth: unsupported algorithm %q", c.algorithm)
+	}
+	h := func(s string) string {
+		sum := newHash()
+		sum.Write([]byte(s))
+		return hex.EncodeToString(sum.Sum(nil))
+	}
+
+	cnonce, err := a.cnonce()
+	if err != nil {
+		return "", err
+	}
+	uri := req.URL.RequestURI()
+	ncValue := fmt.Sprintf("%08x", nc)
+
+	ha1 := h(a.username + ":" + c.realm + ":" + a.password)
+	if strings.HasSuffix(algorithm, "-SESS") {
+		ha1 = h(ha1 + ":" + c.nonce + ":" + cnonce)
+	}
+	ha2 := h(req.Method + ":" + uri)
+	if c.qop == "auth-int" {
+		body, err := readRequestBody(req)
+		if err != nil {
+			return "", err
+		}
+		ha2 = h(req.Method + ":" + uri + ":" + h(string(body)))
+	}
+
+	var response string
+	if c.qop == "" {
+		response = h(ha1 + ":" + c.nonce + ":" + ha2)
+	} else {
+		response = h(ha1 + ":" + c.nonce + ":" + ncValue + ":" + cnonce + ":" + c.qop + ":" + ha2)
+	}
+
+	params := []string{
+		fmt.Sprintf("username=%q", a.username),
+		fmt.Sprintf("realm=%q", c.realm),
+		fmt.Sprintf("nonce=%q", c.nonce),
+		fmt.Sprintf("uri=%q", uri),
+	}
+	if c.algorithm != "" {
+		params = append(params, "algorithm="+c.algorithm)
+	}
+	if c.qop != "" {
+		params = append(params, "qop="+c.qop, "nc="+ncValue, fmt.Sprintf("cnonce=%q", cnonce))
+	}
+	params = append(params, fmt.Sprintf("response=%q", response))
+	if c.opaque != "" {
+		params = append(params, fmt.Sprintf("opaque=%q", c.opaque))
+	}
+	return "Digest " + strings.Join(params, ", "), nil
+}
+
+// parseDigestChallenge returns the strongest supported Digest challenge of
+// the WWW-Authenticate header values, and whether it is marked stale.
+func parseDigestChallenge(values []string) (*digestChallenge, bool) {
+	var best *digestChallenge
+	var bestStale bool
+	for _, challenge := range parseChallenges(values) {
+		if !strings.EqualFold(challenge.scheme, "Digest") {
+			continue
+		}
+		params := challenge.params
+		c := &digestChallenge{
+			realm:     params["realm"],
+			nonce:     params["nonce"],
+			opaque:    params["opaque"],
+			algorithm: params["algorithm"],
+		}
+		switch strings.TrimSuffix(strings.ToUpper(c.algorithm), "-SESS") {
+		case "", "MD5", "SHA-256":
+		default:
+			continue
+		}
+		if qop, ok := params["qop"]; ok {
+			for _, option := range strings.Split(qop, ",") {
+				option = strings.TrimSpace(option)
+				if option == "auth" || (option == "auth-int" && c.qop == "") {
+					c.qop = option
+				}
+			}
+			if c.qop == "" {
+				continue
+			}
+		}
+		if best == nil || (strings.HasPrefix(strings.ToUpper(c.algorithm), "SHA-256") && !strings.HasPrefix(strings.ToUpper(best.algorithm), "SHA-256")) {
+			best = c
+			bestStale = strings.EqualFold(params["stale"], "true")
+		}
+	}
+	return best, bestStale
+}
+
+// authChallenge is a WWW-Authenticate challenge with its auth parameters.
+type authChallenge struct {
+	scheme string
+	params map[string]string
+}
+
+// parseChallenges parses the challenges of WWW-Authenticate header values
+// (RFC 9110 section 11.6.1). Parameter names are lowercased.
+func parseChallenges(values []string) []authChallenge {
+	var challenges []authChallenge
+	for _, value := range values {
+		i := 0
+		for i < len(value) {
+			// skip separators
+			for i < len(value) && (value[i] == ' ' || value[i] == ',' || value[i] == '\t') {
+				i++
+			}
+			start := i
+			for i < len(value) && value[i] != ' ' && value[i] != ',' && value[i] != '=' {
+				i++
+			}
+			token := value[start:i]
+			if token == "" {
+				break
+			}
+			// an auth-param of the current challenge
+			if i < len(value) && value[i] == '=' && len(challenges) > 0 {
+				i++
+				var paramValue string
+				if i < len(value) && value[i] == '"' {
+					var b strings.Builder
+					for i++; i < len(value) && value[i] != '"'; i++ {
+						if value[i] == '\\' && i+1 < len(value) {
+							i++
+						}
+						b.WriteByte(value[i])
+					}
+					i++
+					paramValue = b.String()
+				} else {
+					start := i
+					for i < len(value) && value[i] != ',' && value[i] != ' ' {
+						i++
+					}
+					paramValue = value[start:i]
+				}
+				challenges[len(challenges)-1].params[strings.ToLower(token)] = paramValue
+				continue
+			}
+			challenges = append(challenges, authChallenge{scheme: token, params: map[string]string{}})
+		}
+	}
+	return challenges
+}
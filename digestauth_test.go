@@ -0,0 +1,171 @@
+package sling
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDigestAuth_rfc7616(t *testing.T) {
+	// example of RFC 7616 section 3.9.1
+	challenge := `Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=%s, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`
+	cases := []struct {
+		algorithm string
+		response  string
+	}{
+		{"MD5", "8ca523f5e9506fed4657c9700eebdbec"},
+		{"SHA-256", "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"},
+	}
+	for _, c := range cases {
+		parsed, stale := parseDigestChallenge([]string{fmt.Sprintf(challenge, c.algorithm)})
+		if parsed == nil || stale {
+			t.Fatalf("%s: expected a challenge, got %v", c.algorithm, parsed)
+		}
+		auth := &digestAuth{username: "Mufasa", password: "Circle of Life", cnonce: func() (string, error) {
+			return "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ", nil
+		}}
+		req, _ := http.NewRequest("GET", "http://www.example.org/dir/index.html", nil)
+		authorization, err := auth.authorization(req, parsed, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := fmt.Sprintf(`Digest username="Mufasa", realm="http-auth@example.org", nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", uri="/dir/index.html", algorithm=%s, qop=auth, nc=00000001, cnonce="f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ", response="%s", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`, c.algorithm, c.response)
+		if authorization != expected {
+			t.Errorf("%s: expected Authorization\n%s\ngot\n%s", c.algorithm, expected, authorization)
+		}
+	}
+}
+
+func TestParseDigestChallenge(t *testing.T) {
+	cases := []struct {
+		values    []string
+		algorithm string
+		qop       string
+		stale     bool
+	}{
+		{[]string{`Digest realm="r", nonce="n"`}, "", "", false},
+		{[]string{`Basic realm="r", Digest realm="r", nonce="n", qop="auth-int"`}, "", "auth-int", false},
+		{[]string{`Digest realm="r", nonce="n", algorithm=MD5, qop="auth", stale=TRUE`, `Digest realm="r", nonce="n", algorithm=SHA-256, qop="auth"`}, "SHA-256", "auth", false},
+		{[]string{`Digest realm="r", nonce="n", algorithm=MD5-sess, qop="auth", stale=true`}, "MD5-sess", "auth", true},
+	}
+	for _, c := range cases {
+		challenge, stale := parseDigestChallenge(c.values)
+		if challenge == nil {
+			t.Errorf("%v: expected a challenge", c.values)
+			continue
+		}
+		if challenge.algorithm != c.algorithm || challenge.qop != c.qop || stale != c.stale {
+			t.Errorf("%v: expected algorithm %q qop %q stale %v, got %+v stale %v", c.values, c.algorithm, c.qop, c.stale, challenge, stale)
+		}
+	}
+
+	for _, values := range [][]string{{`Basic realm="r"`}, {`Digest realm="r", nonce="n", algorithm=SHA-512-256`}, {`Digest realm="r", nonce="n", qop="other"`}} {
+		if challenge, _ := parseDigestChallenge(values); challenge != nil {
+			t.Errorf("%v: expected no supported challenge, got %+v", values, challenge)
+		}
+	}
+}
+
+// digestServer requires MD5 digest authentication with qop=auth, recording
+// the nonce counts and bodies of authorized requests.
+type digestServer struct {
+	mu     sync.Mutex
+	nonce  string
+	stale  bool
+	counts []string
+	bodies []string
+	hits   int
+}
+
+func (d *digestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.hits++
+	body, _ := io.ReadAll(r.Body)
+
+	challenges := parseChallenges(r.Header.Values("Authorization"))
+	if len(challenges) == 1 && challenges[0].params["nonce"] == d.nonce {
+		p := challenges[0].params
+		h := func(s string) string {
+			sum := md5.Sum([]byte(s))
+			return hex.EncodeToString(sum[:])
+		}
+		ha1 := h(p["username"] + ":test:" + "secret")
+		ha2 := h(r.Method + ":" + r.URL.RequestURI())
+		if p["uri"] == r.URL.RequestURI() && p["response"] == h(ha1+":"+d.nonce+":"+p["nc"]+":"+p["cnonce"]+":auth:"+ha2) {
+			d.counts = append(d.counts, p["nc"])
+			d.bodies = append(d.bodies, string(body))
+			w.Header().Set("Content-Type", jsonContentType)
+			fmt.Fprint(w, `{"text": "ok"}`)
+			return
+		}
+	}
+	challenge := fmt.Sprintf(`Digest realm="test", nonce=%q, qop="auth", algorithm=MD5`, d.nonce)
+	if d.stale {
+		challenge += ", stale=true"
+	}
+	w.Header().Add("WWW-Authenticate", `Basic realm="test"`)
+	w.Header().Add("WWW-Authenticate", challenge)
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+func TestSetDigestAuth(t *testing.T) {
+	digest := &digestServer{nonce: "nonce-1"}
+	server := httptest.NewServer(digest)
+	defer server.Close()
+
+	base := New().Base(server.URL).SetDigestAuth("user", "secret")
+	for i := 0; i < 3; i++ {
+		model := new(FakeModel)
+		// a Body reader can only be read once, so it is buffered for the retry
+		resp, err := base.New().Post("/things").Body(strings.NewReader(fmt.Sprintf("body %d", i))).ReceiveSuccess(model)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != 200 || model.Text != "ok" {
+			t.Errorf("expected an authorized response, got %d %+v", resp.StatusCode, model)
+		}
+	}
+	// the challenge is cached after the first request
+	if digest.hits != 4 {
+		t.Errorf("expected 4 requests, got %d", digest.hits)
+	}
+	if expected := []string{"00000001", "00000002", "00000003"}; fmt.Sprint(digest.counts) != fmt.Sprint(expected) {
+		t.Errorf("expected nonce counts %v, got %v", expected, digest.counts)
+	}
+	if expected := []string{"body 0", "body 1", "body 2"}; fmt.Sprint(digest.bodies) != fmt.Sprint(expected) {
+		t.Errorf("expected bodies %v, got %v", expected, digest.bodies)
+	}
+
+	// a stale nonce is replaced and the nonce count restarts
+	digest.nonce, digest.stale = "nonce-2", true
+	if _, err := base.New().Get("/things").ReceiveSuccess(new(FakeModel)); err != nil {
+		t.Fatal(err)
+	}
+	if last := digest.counts[len(digest.counts)-1]; last != "00000001" {
+		t.Errorf("expected nonce count to restart, got %s", last)
+	}
+}
+
+func TestSetDigestAuth_wrongPassword(t *testing.T) {
+	digest := &digestServer{nonce: "nonce-1"}
+	server := httptest.NewServer(digest)
+	defer server.Close()
+
+	resp, err := New().Base(server.URL).SetDigestAuth("user", "wrong").Get("/things").Receive(nil, new(APIError))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 Unauthorized, got %d", resp.StatusCode)
+	}
+	if digest.hits != 2 {
+		t.Errorf("expected the request to be retried once, got %d requests", digest.hits)
+	}
+}
@@ -0,0 +1,216 @@
+package sling
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// decompressBody decompresses a gzip or deflate response body which the
+// http Transport left compressed, such as when the request set its own
+// Accept-Encoding. As the Transport does, the Content-Encoding and
+// Content-Length headers are removed and Uncompressed is set. Bodies with
+// other encodings are left as they are. The decompressed body is limited by
+// the Sling's MaxResponseSize.
+func (s *Sling) decompressBody(resp *http.Response) {
+	encodings := strings.Split(resp.Header.Get("Content-Encoding"), ",")
+	for _, encoding := range encodings {
+		switch strings.ToLower(strings.TrimSpace(encoding)) {
+		case "gzip", "x-gzip", "deflate", "identity":
+		default:
+			return
+		}
+	}
+
+	var reader io.Reader = resp.Body
+	// encodings are listed in the order they were applied
+	for i := len(encodings) - 1; i >= 0; i-- {
+		switch strings.ToLower(strings.TrimSpace(encodings[i])) {
+		case "gzip", "x-gzip":
+			reader = &gzipReader{r: reader}
+		case "deflate":
+			reader = &deflateReader{r: reader}
+		}
+	}
+	if s.maxResponseSize > 0 {
+		reader = &limitedReader{r: reader, limit: s.maxResponseSize, part: limitResponseBody}
+	}
+	resp.Body = &readAndClose{reader, resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+}
+
+// deflateReader decompresses r, which is zlib wrapped as "deflate" should
+// be, or raw deflate as some servers send.
+type deflateReader struct {
+	r   io.Reader
+	zr  io.Reader
+	err error
+}
+
+func (d *deflateReader) Read(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	if d.zr == nil {
+		br := bufio.NewReader(d.r)
+		header, _ := br.Peek(2)
+		if len(header) == 2 && header[0]&0x0f == 8 && (uint(header[0])<<8|uint(header[1]))%31 == 0 {
+			d.zr, d.err = zlib.NewReader(br)
+		} else {
+			d.zr = flate.NewReader(br)
+		}
+		if d.err != nil {
+			return 0, d.err
+		}
+	}
+	return d.zr.Read(p)
+}
+
+// Byte order marks.
+var (
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+	bomUTF16BE = []byte{0xfe, 0xff}
+	bomUTF16LE = []byte{0xff, 0xfe}
+)
+
+// transcodeBody converts a response body in the charset declared by its
+// Content-Type, or marked by a byte order mark, to UTF-8 and strips the
+// byte order mark. ISO-8859-1, US-ASCII, UTF-8 and UTF-16 are understood;
+// bodies in other charsets are left as they are, as are binary bodies.
+func transcodeBody(resp *http.Response) {
+	mediaType, charset := "", ""
+	if ct := resp.Header.Get(contentType); ct != "" {
+		var params map[string]string
+		var err error
+		if mediaType, params, err = mime.ParseMediaType(ct); err != nil {
+			return
+		}
+		charset = strings.ToLower(params["charset"])
+	}
+	if charset == "" && !isText(mediaType) {
+		return
+	}
+
+	br := bufio.NewReader(resp.Body)
+	bom, _ := br.Peek(3)
+	var next func(*bufio.Reader) (rune, error)
+	switch {
+	case len(bom) >= 3 && string(bom[:3]) == string(bomUTF8):
+		br.Discard(3)
+	case len(bom) >= 2 && string(bom[:2]) == string(bomUTF16BE):
+		br.Discard(2)
+		next = (&utf16Decoder{bigEndian: true}).next
+	case len(bom) >= 2 && string(bom[:2]) == string(bomUTF16LE):
+		br.Discard(2)
+		next = (&utf16Decoder{}).next
+	default:
+		switch charset {
+		case "iso-8859-1", "iso8859-1", "latin1", "l1":
+			next = nextLatin1
+		case "utf-16", "utf-16be":
+			// without a byte order mark, UTF-16 is big endian
+			next = (&utf16Decoder{bigEndian: true}).next
+		case "utf-16le":
+			next = (&utf16Decoder{}).next
+		}
+	}
+
+	var reader io.Reader = br
+	if next != nil {
+		reader = &transcoder{src: br, next: next}
+	}
+	resp.Body = &readAndClose{reader, resp.Body}
+}
+
+// isText reports whether the media type is textual, which a missing media
+// type is taken to be since JSON is decoded regardless of Content-Type.
+func isText(mediaType string) bool {
+	return mediaType == "" || strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "/json") || strings.HasSuffix(mediaType, "+json") ||
+		strings.HasSuffix(mediaType, "/xml") || strings.HasSuffix(mediaType, "+xml")
+}
+
+// transcoder encodes the runes decoded from src as UTF-8.
+type transcoder struct {
+	src     *bufio.Reader
+	next    func(*bufio.Reader) (rune, error)
+	pending []byte
+	scratch [utf8.UTFMax]byte
+}
+
+func (t *transcoder) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(t.pending) > 0 {
+			copied := copy(p[n:], t.pending)
+			t.pending = t.pending[copied:]
+			n += copied
+			continue
+		}
+		r, err := t.next(t.src)
+		if err != nil {
+			return n, err
+		}
+		t.pending = utf8.AppendRune(t.scratch[:0], r)
+	}
+	return n, nil
+}
+
+// nextLatin1 decodes an ISO-8859-1 byte, whose value is its code point.
+func nextLatin1(src *bufio.Reader) (rune, error) {
+	b, err := src.ReadByte()
+	return rune(b), err
+}
+
+// utf16Decoder decodes UTF-16 code units, pairing surrogates.
+type utf16Decoder struct {
+	bigEndian bool
+	unit      rune
+	buffered  bool
+}
+
+func (d *utf16Decoder) readUnit(src *bufio.Reader) (rune, error) {
+	if d.buffered {
+		d.buffered = false
+		return d.unit, nil
+	}
+	var b [2]byte
+	if _, err := io.ReadFull(src, b[:]); err != nil {
+		return 0, err
+	}
+	if d.bigEndian {
+		return rune(b[0])<<8 | rune(b[1]), nil
+	}
+	return rune(b[1])<<8 | rune(b[0]), nil
+}
+
+func (d *utf16Decoder) next(src *bufio.Reader) (rune, error) {
+	unit, err := d.readUnit(src)
+	if err != nil {
+		return 0, err
+	}
+	if !utf16.IsSurrogate(unit) {
+		return unit, nil
+	}
+	low, err := d.readUnit(src)
+	if err == io.EOF {
+		return utf8.RuneError, nil
+	} else if err != nil {
+		return 0, err
+	}
+	if r := utf16.DecodeRune(unit, low); r != utf8.RuneError {
+		return r, nil
+	}
+	// keep a unit which doesn't complete the pair for the next rune
+	d.unit, d.buffered = low, true
+	return utf8.RuneError, nil
+}
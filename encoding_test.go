@@ -0,0 +1,111 @@
+package sling
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// rawDecoder decodes response bodies as they are into a *[]byte.
+type rawDecoder struct{}
+
+func (rawDecoder) Decode(resp *http.Response, v interface{}) error {
+	body, err := io.ReadAll(resp.Body)
+	*v.(*[]byte) = body
+	return err
+}
+
+func utf16Bytes(s string, bigEndian bool) []byte {
+	var b []byte
+	for _, unit := range utf16.Encode([]rune(s)) {
+		if bigEndian {
+			b = append(b, byte(unit>>8), byte(unit))
+		} else {
+			b = append(b, byte(unit), byte(unit>>8))
+		}
+	}
+	return b
+}
+
+func TestDecode_encodings(t *testing.T) {
+	body := `{"text": "café 🩺"}`
+	compress := func(w io.WriteCloser, buf *bytes.Buffer) []byte {
+		w.Write([]byte(body))
+		w.Close()
+		return buf.Bytes()
+	}
+	var gzipped, zlibbed, deflated bytes.Buffer
+	flateWriter, _ := flate.NewWriter(&deflated, flate.DefaultCompression)
+
+	cases := []struct {
+		contentType     string
+		contentEncoding string
+		body            []byte
+	}{
+		{jsonContentType, "", []byte(body)},
+		{jsonContentType, "gzip", compress(gzip.NewWriter(&gzipped), &gzipped)},
+		{jsonContentType, "deflate", compress(zlib.NewWriter(&zlibbed), &zlibbed)},
+		{jsonContentType, "deflate", compress(flateWriter, &deflated)},
+		{jsonContentType, "", append(append([]byte{}, bomUTF8...), body...)},
+		{jsonContentType + "; charset=utf-16", "", append(append([]byte{}, bomUTF16BE...), utf16Bytes(body, true)...)},
+		{"", "", append(append([]byte{}, bomUTF16LE...), utf16Bytes(body, false)...)},
+		{jsonContentType + "; charset=UTF-16LE", "", utf16Bytes(body, false)},
+		{jsonContentType + "; charset=utf-16", "", utf16Bytes(body, true)},
+	}
+	for _, c := range cases {
+		resp := &http.Response{StatusCode: 200, ContentLength: int64(len(c.body)), Header: http.Header{}, Body: io.NopCloser(bytes.NewReader(c.body))}
+		resp.Header.Set(contentType, c.contentType)
+		if c.contentEncoding != "" {
+			resp.Header.Set("Content-Encoding", c.contentEncoding)
+		}
+		model := new(FakeModel)
+		response, err := New().Doer(&fakeDoer{Response: resp}).doDecode(nil, model, nil)
+		if err != nil || model.Text != "café 🩺" {
+			t.Errorf("%s %s: expected café 🩺, got %q, %v", c.contentType, c.contentEncoding, model.Text, err)
+		}
+		if c.contentEncoding != "" && (!response.Uncompressed || response.Header.Get("Content-Encoding") != "") {
+			t.Errorf("expected the response to be marked uncompressed, got %+v", response)
+		}
+	}
+}
+
+func TestDecode_charsets(t *testing.T) {
+	cases := []struct {
+		contentType string
+		body        []byte
+		expected    string
+	}{
+		{"text/plain; charset=ISO-8859-1", []byte("caf\xe9 \xa9"), "café ©"},
+		{"text/plain; charset=us-ascii", []byte("abc"), "abc"},
+		{"text/plain; charset=utf-16be", utf16Bytes("a🩺b", true), "a🩺b"},
+		// unpaired surrogates are replaced
+		{"text/plain; charset=utf-16be", []byte{0xd8, 0x3e, 0x00, 0x61}, "�a"},
+		{"text/plain; charset=utf-16be", []byte{0xdc, 0x00}, "�"},
+		// other charsets and binary bodies are left as they are
+		{"text/plain; charset=koi8-r", []byte{0xc1}, "\xc1"},
+		{"application/octet-stream", []byte{0xff, 0xfe, 0x01}, "\xff\xfe\x01"},
+		{"text/plain", []byte{0xef, 0xbb, 0xbf, 'x'}, "x"},
+	}
+	for _, c := range cases {
+		resp := &http.Response{StatusCode: 200, ContentLength: int64(len(c.body)), Header: http.Header{contentType: {c.contentType}}, Body: io.NopCloser(bytes.NewReader(c.body))}
+		var body []byte
+		_, err := New().Doer(&fakeDoer{Response: resp}).ResponseDecoder(rawDecoder{}).doDecode(nil, &body, nil)
+		if err != nil || string(body) != c.expected {
+			t.Errorf("%s: expected %q, got %q, %v", c.contentType, c.expected, body, err)
+		}
+	}
+
+	// other encodings are left to the decoder
+	resp := &http.Response{StatusCode: 200, ContentLength: 3, Header: http.Header{"Content-Encoding": {"br"}}, Body: io.NopCloser(strings.NewReader("abc"))}
+	var body []byte
+	response, err := New().Doer(&fakeDoer{Response: resp}).ResponseDecoder(rawDecoder{}).doDecode(nil, &body, nil)
+	if err != nil || string(body) != "abc" || response.Header.Get("Content-Encoding") != "br" {
+		t.Errorf("expected the br body to be left as it is, got %q, %v", body, err)
+	}
+}
@@ -0,0 +1,113 @@
+package sling
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// defaultErrorBodyCap is the default cap on the bytes of body snippets in
+// error messages.
+const defaultErrorBodyCap = 100
+
+// defaultErrorBodyRetainCap is the cap on the bytes of retained error bodies
+// when the Sling has no MaxResponseSize.
+const defaultErrorBodyRetainCap = 1 << 20
+
+// ErrorBodyCapture sets how the bodies of responses which fail, with a
+// non-2XX status or a decoding error, are captured.
+type ErrorBodyCapture struct {
+	// MaxBytes caps the bytes of the body snippet in error messages. Zero
+	// captures 100 bytes and a negative value leaves snippets out.
+	MaxBytes int
+	// ContentTypes are the media types of bodies which are captured, such
+	// as "application/json" or "text/*". If empty, any body is captured.
+	ContentTypes []string
+	// PrettyJSON indents JSON body snippets.
+	PrettyJSON bool
+	// Retain keeps the whole body of non-2XX responses on the Response's
+	// ErrorBody, whether or not it is captured for error messages, up to the
+	// Sling's MaxResponseSize or, without one, 1MiB. Retained bodies aren't
+	// masked by the Sling's RedactionPolicy.
+	Retain bool
+}
+
+// ErrorBodies sets how the bodies of failed responses are captured for error
+// messages and retained on the Response.
+func (s *Sling) ErrorBodies(capture ErrorBodyCapture) *Sling {
+	capture.ContentTypes = append([]string{}, capture.ContentTypes...)
+	s.errorBodies = capture
+	return s
+}
+
+// maxBytes returns the cap on the bytes of body snippets, zero for none.
+func (c ErrorBodyCapture) maxBytes() int {
+	switch {
+	case c.MaxBytes < 0:
+		return 0
+	case c.MaxBytes == 0:
+		return defaultErrorBodyCap
+	}
+	return c.MaxBytes
+}
+
+// errorBodyRetainCap returns the cap on the bytes of retained error bodies.
+func (s *Sling) errorBodyRetainCap() int {
+	if s.maxResponseSize > 0 && s.maxResponseSize < int64(^uint(0)>>1) {
+		return int(s.maxResponseSize)
+	}
+	return defaultErrorBodyRetainCap
+}
+
+// captures reports whether bodies of the media type are captured.
+func (c ErrorBodyCapture) captures(contentType string) bool {
+	if len(c.ContentTypes) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range c.ContentTypes {
+		pattern = strings.ToLower(pattern)
+		if pattern == mediaType || strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mediaType, pattern[:len(pattern)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// snippetCapture returns the bytes of the response body to capture for an
+// error body snippet, zero for none. Snippets are masked and reformatted
+// before they are cut to size, so more is captured when they will be.
+func (s *Sling) snippetCapture(resp *http.Response, values ...interface{}) int {
+	max := s.errorBodies.maxBytes()
+	if max == 0 || s.redaction != nil && s.redaction.OmitBodySnippets || !s.errorBodies.captures(resp.Header.Get(contentType)) {
+		return 0
+	}
+	if (s.errorBodies.PrettyJSON || s.redaction.masksBodies(values...)) && max < redactionCaptureCap {
+		return redactionCaptureCap
+	}
+	return max
+}
+
+// snippet formats a captured response body for error messages. The body was
+// truncated if the response had more bytes than were captured.
+func (s *Sling) snippet(resp *http.Response, body []byte, truncated bool, values ...interface{}) string {
+	body = s.redaction.maskCaptured(body, truncated, resp.Header.Get(contentType), values...)
+	if s.errorBodies.PrettyJSON && !truncated {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, body, "", "  "); err == nil {
+			body = indented.Bytes()
+		}
+	}
+	if max := s.errorBodies.maxBytes(); len(body) > max {
+		body, truncated = body[:max], true
+	}
+	if truncated {
+		return string(body) + " (truncated)"
+	}
+	return string(body)
+}
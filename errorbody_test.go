@@ -0,0 +1,136 @@
+package sling
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestErrorBodies(t *testing.T) {
+	body := `{"error":"not found","detail":"` + strings.Repeat("x", 120) + `"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, r.URL.Query().Get("type"))
+		w.WriteHeader(404)
+		fmt.Fprint(w, r.URL.Query().Get("body"))
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		capture     ErrorBodyCapture
+		contentType string
+		body        string
+		expected    string
+	}{
+		{ErrorBodyCapture{}, jsonContentType, body, "status code 404 was not successful, got body: " + body[:100] + " (truncated)"},
+		{ErrorBodyCapture{MaxBytes: 200}, jsonContentType, body, "status code 404 was not successful, got body: " + body},
+		{ErrorBodyCapture{MaxBytes: 9}, jsonContentType, body, `status code 404 was not successful, got body: {"error": (truncated)`},
+		{ErrorBodyCapture{MaxBytes: -1}, jsonContentType, body, "status code 404 was not successful"},
+		{ErrorBodyCapture{ContentTypes: []string{"text/*"}}, "text/plain; charset=utf-8", "oops", "status code 404 was not successful, got body: oops"},
+		{ErrorBodyCapture{ContentTypes: []string{"application/json"}}, "text/html", "<html>", "status code 404 was not successful"},
+		{ErrorBodyCapture{ContentTypes: []string{"application/json"}}, "Application/JSON; charset=utf-8", `{}`, "status code 404 was not successful, got body: {}"},
+		{ErrorBodyCapture{PrettyJSON: true}, jsonContentType, `{"a":1,"b":[2]}`, "status code 404 was not successful, got body: {\n  \"a\": 1,\n  \"b\": [\n    2\n  ]\n}"},
+		{ErrorBodyCapture{PrettyJSON: true, MaxBytes: 10}, jsonContentType, `{"a":1,"b":[2]}`, "status code 404 was not successful, got body: {\n  \"a\": 1 (truncated)"},
+		{ErrorBodyCapture{PrettyJSON: true}, "text/plain", "not json", "status code 404 was not successful, got body: not json"},
+	}
+	for _, c := range cases {
+		s := New().Base(server.URL).QueryValues(map[string][]string{"type": {c.contentType}, "body": {c.body}}).ErrorBodies(c.capture)
+		_, err := s.ReceiveSuccess(new(FakeModel))
+		if err == nil || err.Error() != c.expected {
+			t.Errorf("expected %q, got %v", c.expected, err)
+		}
+	}
+}
+
+func TestErrorBodies_decode(t *testing.T) {
+	body := `{"message": 5, "padding": "` + strings.Repeat("x", 200) + `"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, jsonContentType)
+		w.WriteHeader(500)
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+
+	apiError := new(APIError)
+	resp, err := New().Base(server.URL).ErrorBodies(ErrorBodyCapture{MaxBytes: 11, Retain: true}).Receive(nil, apiError)
+	if expected := `got body "{\"message\": (truncated)"`; err == nil || !strings.HasSuffix(err.Error(), expected) {
+		t.Errorf("expected error ending with %s, got %v", expected, err)
+	}
+	if string(resp.ErrorBody) != body {
+		t.Errorf("expected the whole body to be retained, got %q", resp.ErrorBody)
+	}
+
+	resp, err = New().Base(server.URL).ErrorBodies(ErrorBodyCapture{ContentTypes: []string{"text/plain"}}).Receive(nil, apiError)
+	if err == nil || strings.Contains(err.Error(), "got body") {
+		t.Errorf("expected no body snippet, got %v", err)
+	}
+	if resp.ErrorBody != nil {
+		t.Errorf("expected no retained body, got %q", resp.ErrorBody)
+	}
+}
+
+func TestErrorBodies_retainCap(t *testing.T) {
+	body := strings.Repeat("x", defaultErrorBodyRetainCap+10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, "text/plain")
+		w.WriteHeader(500)
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		sling    *Sling
+		expected int
+	}{
+		// without a MaxResponseSize, retained bodies are capped by default
+		{New(), defaultErrorBodyRetainCap},
+		{New().RetainBody(defaultErrorBodyRetainCap + 20), defaultErrorBodyRetainCap},
+		{New().MaxResponseSize(int64(len(body))), len(body)},
+	}
+	for _, c := range cases {
+		resp, err := c.sling.Get(server.URL).ErrorBodies(ErrorBodyCapture{Retain: true}).Receive(nil, new(APIError))
+		if err == nil {
+			t.Errorf("expected an error")
+		}
+		truncated := c.expected < len(body)
+		if resp == nil || len(resp.ErrorBody) != c.expected || resp.ErrorBodyTruncated != truncated {
+			t.Errorf("expected %d bytes retained, truncated %t, got %d, %t", c.expected, truncated, len(resp.ErrorBody), resp.ErrorBodyTruncated)
+		}
+	}
+}
+
+func TestErrorBodies_retainSuccess(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentType, jsonContentType)
+		fmt.Fprint(w, `{"text": "Some text"}`)
+	}))
+	defer server.Close()
+
+	resp, err := New().Base(server.URL).ErrorBodies(ErrorBodyCapture{Retain: true}).ReceiveSuccess(new(FakeModel))
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if resp.ErrorBody != nil {
+		t.Errorf("expected success bodies not to be retained, got %q", resp.ErrorBody)
+	}
+}
+
+func TestMaxSizeWriter(t *testing.T) {
+	w := newMaxSizeWriter(redactionCaptureCap)
+	if cap(w.bytes()) != 0 {
+		t.Errorf("expected no bytes to be allocated up front, got capacity %d", cap(w.bytes()))
+	}
+	w.Write([]byte("abc"))
+	w.Write([]byte("def"))
+	if string(w.bytes()) != "abcdef" || w.truncated() {
+		t.Errorf("expected abcdef, got %q", w.bytes())
+	}
+
+	w = newMaxSizeWriter(4)
+	w.Write([]byte("abc"))
+	w.Write([]byte("def"))
+	if string(w.bytes()) != "abcd" || !w.truncated() {
+		t.Errorf("expected abcd truncated, got %q", w.bytes())
+	}
+}
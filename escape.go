@@ -0,0 +1,21 @@
+package sling
+
+import (
+	"fmt"
+	"strings"
+)
+
+// escapeUnreserved percent-encodes every byte except the RFC 3986
+// unreserved characters, as required by SigV4 and OAuth 1.0a.
+func escapeUnreserved(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
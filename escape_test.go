@@ -0,0 +1,17 @@
+package sling
+
+import "testing"
+
+func TestEscapeUnreserved(t *testing.T) {
+	cases := map[string]string{
+		"abcABC123-._~": "abcABC123-._~",
+		"a b+c":         "a%20b%2Bc",
+		"é":             "%C3%A9",
+		"=%&":           "%3D%25%26",
+	}
+	for input, expected := range cases {
+		if got := escapeUnreserved(input); got != expected {
+			t.Errorf("escapeUnreserved(%q): expected %s, got %s", input, expected, got)
+		}
+	}
+}
@@ -0,0 +1,525 @@
+package sling
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const harTruncated = "truncated"
+
+// harCreatorVersion is the creator version of HAR documents, which HAR 1.2
+// requires.
+const harCreatorVersion = "1"
+
+// HAR is an HTTP Archive 1.2 document.
+// See http://www.softwareishard.com/blog/har-12-spec/ for details.
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog is the root of exported HAR data.
+type HARLog struct {
+	Version string      `json:"version"`
+	Creator HARCreator  `json:"creator"`
+	Entries []*HAREntry `json:"entries"`
+}
+
+// HARCreator is the application which created the log.
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is a single recorded request and response exchange.
+type HAREntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+// HARRequest is a recorded request.
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARResponse is a recorded response.
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARNameValue is a header, cookie or query parameter.
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData is a recorded request body.
+type HARPostData struct {
+	MimeType string         `json:"mimeType"`
+	Params   []HARNameValue `json:"params,omitempty"`
+	Text     string         `json:"text"`
+	Comment  string         `json:"comment,omitempty"`
+}
+
+// HARContent is a recorded response body. Bodies which are not valid UTF-8
+// are base64 encoded.
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARTimings are the durations, in milliseconds, of the phases of an
+// exchange. Phases which don't apply, such as dns for a reused connection,
+// are -1.
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// HARRecorder records every exchange sent through it in HAR 1.2 format. Use
+// Wrap as a Sling Middleware or to wrap any Doer:
+//
+//	recorder := sling.NewHARRecorder()
+//	s := sling.New().Use(recorder.Wrap)
+//	...
+//	recorder.WriteTo(file)
+//
+// A HARRecorder is safe for concurrent use.
+type HARRecorder struct {
+	// MaxBodySize caps the bytes of each request and response body which are
+	// recorded. Larger bodies are truncated, and request bodies are only
+	// read this far, so their size is recorded as -1 unless the
+	// Content-Length is known. Zero records bodies in full.
+	MaxBodySize int
+	// RedactHeaders are header names whose values are recorded as "REDACTED".
+	RedactHeaders []string
+	// RedactQuery are query parameter names whose values are recorded as
+	// "REDACTED".
+	RedactQuery []string
+	// Redaction masks sensitive headers, query parameters and body values.
+	// If nil, the RedactionPolicy of the Sling which sent the request is used.
+	Redaction *RedactionPolicy
+
+	mu      sync.Mutex
+	entries []*HAREntry
+}
+
+// NewHARRecorder returns a new HARRecorder which redacts Authorization,
+// Proxy-Authorization and Cookie headers.
+func NewHARRecorder() *HARRecorder {
+	return &HARRecorder{
+		RedactHeaders: []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"},
+	}
+}
+
+// Wrap returns a Doer which records exchanges sent through next.
+func (r *HARRecorder) Wrap(next Doer) Doer {
+	return DoerFunc(func(req *http.Request) (*http.Response, error) {
+		return r.do(next, req)
+	})
+}
+
+// Entries returns copies of the entries recorded so far. Entries for
+// responses whose bodies have not been closed are incomplete.
+func (r *HARRecorder) Entries() []*HAREntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.copyEntries()
+}
+
+// Reset discards all recorded entries.
+func (r *HARRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = nil
+}
+
+// HAR returns the recorded entries as a HAR document.
+func (r *HARRecorder) HAR() *HAR {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &HAR{Log: HARLog{
+		Version: "1.2",
+		Creator: HARCreator{Name: "sling", Version: harCreatorVersion},
+		Entries: r.copyEntries(),
+	}}
+}
+
+// copyEntries returns deep copies of the entries, which are still updated
+// as response bodies are read. r.mu must be held.
+func (r *HARRecorder) copyEntries() []*HAREntry {
+	entries := make([]*HAREntry, len(r.entries))
+	for i, entry := range r.entries {
+		copied := *entry
+		copied.Request.Cookies = copyNameValues(entry.Request.Cookies)
+		copied.Request.Headers = copyNameValues(entry.Request.Headers)
+		copied.Request.QueryString = copyNameValues(entry.Request.QueryString)
+		if entry.Request.PostData != nil {
+			postData := *entry.Request.PostData
+			postData.Params = copyNameValues(postData.Params)
+			copied.Request.PostData = &postData
+		}
+		copied.Response.Cookies = copyNameValues(entry.Response.Cookies)
+		copied.Response.Headers = copyNameValues(entry.Response.Headers)
+		entries[i] = &copied
+	}
+	return entries
+}
+
+// copyNameValues copies values, keeping an empty slice non-nil so it is
+// encoded as [].
+func copyNameValues(values []HARNameValue) []HARNameValue {
+	if values == nil {
+		return nil
+	}
+	return append([]HARNameValue{}, values...)
+}
+
+// WriteTo writes the recorded entries as an indented HAR JSON document.
+func (r *HARRecorder) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.MarshalIndent(r.HAR(), "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(b, '\n'))
+	return int64(n), err
+}
+
+func (r *HARRecorder) do(next Doer, req *http.Request) (*http.Response, error) {
+	entry := &HAREntry{StartedDateTime: time.Now()}
+	policy := requestRedaction(req, r.Redaction)
+	entry.Request = r.harRequest(req, policy)
+
+	timer := &harTimer{start: entry.StartedDateTime}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), timer.trace()))
+
+	resp, err := next.Do(req)
+	timer.mark(&timer.responded)
+	if err != nil {
+		entry.Comment = err.Error()
+		entry.Response = HARResponse{Cookies: []HARNameValue{}, Headers: []HARNameValue{}, HeadersSize: -1, BodySize: -1}
+		r.mu.Lock()
+		r.entries = append(r.entries, entry)
+		r.mu.Unlock()
+		r.finish(entry, timer)
+		return resp, err
+	}
+
+	entry.Response = r.harResponse(resp, policy)
+	entry.ServerIPAddress = timer.serverAddr()
+	r.mu.Lock()
+	r.entries = append(r.entries, entry)
+	r.mu.Unlock()
+
+	resp.Body = &captureBody{
+		ReadCloser: resp.Body,
+		max:        r.maxBodySize(),
+		finish: func(content []byte, size int64) {
+			truncated := size > int64(len(content))
+			content = policy.maskCaptured(content, truncated, resp.Header.Get(contentType))
+			r.mu.Lock()
+			entry.Response.Content.Size = size
+			entry.Response.BodySize = size
+			entry.Response.Content.Text, entry.Response.Content.Encoding = harText(content)
+			if truncated {
+				entry.Response.Content.Comment = harTruncated
+			}
+			r.mu.Unlock()
+			r.finish(entry, timer)
+		},
+	}
+	return resp, nil
+}
+
+// finish fills in the entry timings once the response body has been read.
+func (r *HARRecorder) finish(entry *HAREntry, timer *harTimer) {
+	done := time.Now()
+	timings := timer.timings(done)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry.Timings = timings
+	entry.Time = sinceMillis(timer.start, done)
+}
+
+func (r *HARRecorder) maxBodySize() int {
+	if r.MaxBodySize > 0 {
+		return r.MaxBodySize
+	}
+	return int(^uint(0) >> 1)
+}
+
+func (r *HARRecorder) harRequest(req *http.Request, policy *RedactionPolicy) HARRequest {
+	u := *policy.maskURL(req.URL)
+	query := u.Query()
+	for _, key := range r.RedactQuery {
+		if _, ok := query[key]; ok {
+			for i := range query[key] {
+				query[key][i] = redacted
+			}
+		}
+	}
+	if len(r.RedactQuery) > 0 {
+		u.RawQuery = query.Encode()
+	}
+
+	harReq := HARRequest{
+		Method:      req.Method,
+		URL:         u.String(),
+		HTTPVersion: harVersion(req.Proto),
+		Cookies:     harCookies(req.Cookies()),
+		Headers:     r.harHeaders(req.Header, policy),
+		QueryString: harValues(query),
+		HeadersSize: -1,
+		BodySize:    0,
+	}
+
+	max := r.maxBodySize()
+	body, size, err := captureRequestBody(req, max)
+	if err != nil || len(body) == 0 {
+		return harReq
+	}
+	harReq.BodySize = size
+	postData := &HARPostData{MimeType: req.Header.Get(contentType)}
+	complete := size == int64(len(body))
+	body = policy.maskCaptured(body, !complete, postData.MimeType)
+	if strings.HasPrefix(postData.MimeType, formContentType) && complete {
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			postData.Params = harValues(values)
+		}
+	}
+	text := body
+	if len(text) > max {
+		text = text[:max]
+		postData.Comment = harTruncated
+	}
+	postData.Text = string(text)
+	harReq.PostData = postData
+	return harReq
+}
+
+func (r *HARRecorder) harResponse(resp *http.Response, policy *RedactionPolicy) HARResponse {
+	return HARResponse{
+		Status:      resp.StatusCode,
+		StatusText:  harStatusText(resp),
+		HTTPVersion: harVersion(resp.Proto),
+		Cookies:     harCookies(resp.Cookies()),
+		Headers:     r.harHeaders(resp.Header, policy),
+		Content:     HARContent{MimeType: resp.Header.Get(contentType)},
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+}
+
+func harStatusText(resp *http.Response) string {
+	if text := strings.TrimPrefix(resp.Status, strconv.Itoa(resp.StatusCode)+" "); text != resp.Status {
+		return text
+	}
+	return http.StatusText(resp.StatusCode)
+}
+
+func (r *HARRecorder) harHeaders(header http.Header, policy *RedactionPolicy) []HARNameValue {
+	redact := make(map[string]bool, len(r.RedactHeaders))
+	for _, key := range r.RedactHeaders {
+		redact[http.CanonicalHeaderKey(key)] = true
+	}
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	nvs := []HARNameValue{}
+	for _, key := range keys {
+		for _, value := range header[key] {
+			if redact[key] || policy.masksHeader(key) {
+				value = redacted
+			}
+			nvs = append(nvs, HARNameValue{Name: key, Value: value})
+		}
+	}
+	return nvs
+}
+
+func harValues(values url.Values) []HARNameValue {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	nvs := []HARNameValue{}
+	for _, key := range keys {
+		for _, value := range values[key] {
+			nvs = append(nvs, HARNameValue{Name: key, Value: value})
+		}
+	}
+	return nvs
+}
+
+// harCookies records cookie names only. Cookie values are credentials.
+func harCookies(cookies []*http.Cookie) []HARNameValue {
+	nvs := []HARNameValue{}
+	for _, cookie := range cookies {
+		nvs = append(nvs, HARNameValue{Name: cookie.Name, Value: redacted})
+	}
+	return nvs
+}
+
+func harVersion(proto string) string {
+	if proto == "" {
+		return "HTTP/1.1"
+	}
+	return proto
+}
+
+// harText returns body as text, or base64 encoded if it is not valid UTF-8.
+func harText(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+// harTimer collects httptrace events for an exchange.
+type harTimer struct {
+	mu                     sync.Mutex
+	start                  time.Time
+	dnsStart, dnsDone      time.Time
+	connectStart, connDone time.Time
+	tlsStart, tlsDone      time.Time
+	gotConn                time.Time
+	wroteRequest           time.Time
+	firstByte              time.Time
+	responded              time.Time
+	remoteAddr             string
+}
+
+// mark sets the field to the current time. Trace hooks may be called from
+// transport goroutines.
+func (t *harTimer) mark(field *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	*field = time.Now()
+}
+
+func (t *harTimer) serverAddr() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.remoteAddr
+}
+
+func (t *harTimer) trace() *httptrace.ClientTrace {
+	now := t.mark
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { now(&t.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { now(&t.dnsDone) },
+		ConnectStart:         func(string, string) { now(&t.connectStart) },
+		ConnectDone:          func(string, string, error) { now(&t.connDone) },
+		TLSHandshakeStart:    func() { now(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { now(&t.tlsDone) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { now(&t.wroteRequest) },
+		GotFirstResponseByte: func() { now(&t.firstByte) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			now(&t.gotConn)
+			if addr := info.Conn.RemoteAddr(); addr != nil {
+				t.mu.Lock()
+				t.remoteAddr = addr.String()
+				t.mu.Unlock()
+			}
+		},
+	}
+}
+
+func (t *harTimer) timings(done time.Time) HARTimings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	timings := HARTimings{
+		Blocked: -1,
+		DNS:     durationMillis(t.dnsStart, t.dnsDone),
+		Connect: durationMillis(t.connectStart, t.connDone),
+		SSL:     durationMillis(t.tlsStart, t.tlsDone),
+	}
+	// connect includes ssl time in HAR 1.2
+	if timings.Connect >= 0 && timings.SSL >= 0 {
+		timings.Connect += timings.SSL
+	}
+	connStart := t.start
+	switch {
+	case !t.dnsStart.IsZero():
+		connStart = t.dnsStart
+	case !t.connectStart.IsZero():
+		connStart = t.connectStart
+	}
+	if !t.gotConn.IsZero() {
+		timings.Blocked = durationMillis(t.start, connStart)
+	}
+	sendStart := t.gotConn
+	if sendStart.IsZero() {
+		sendStart = t.start
+	}
+	timings.Send = durationMillis(sendStart, t.wroteRequest)
+	timings.Wait = durationMillis(t.wroteRequest, t.firstByte)
+	receiveStart := t.firstByte
+	if receiveStart.IsZero() {
+		receiveStart = t.responded
+	}
+	timings.Receive = durationMillis(receiveStart, done)
+	for _, phase := range []*float64{&timings.Send, &timings.Wait, &timings.Receive} {
+		if *phase < 0 {
+			*phase = 0
+		}
+	}
+	return timings
+}
+
+// durationMillis returns the milliseconds between start and end, or -1 if
+// either is unknown.
+func durationMillis(start, end time.Time) float64 {
+	if start.IsZero() || end.IsZero() {
+		return -1
+	}
+	return sinceMillis(start, end)
+}
+
+func sinceMillis(start, end time.Time) float64 {
+	return float64(end.Sub(start)) / float64(time.Millisecond)
+}
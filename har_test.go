@@ -0,0 +1,195 @@
+package sling
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHARRecorder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(201)
+		fmt.Fprintf(w, `{"text": "Some text", "favorite_count": 24}`)
+	}))
+	defer server.Close()
+
+	recorder := NewHARRecorder()
+	recorder.MaxBodySize = 20
+	recorder.RedactQuery = []string{"token"}
+	s := New().Base(server.URL+"/").Use(recorder.Wrap).SetBasicAuth("user", "pass")
+
+	model := new(FakeModel)
+	_, err := s.New().Post("foo").QueryStruct(paramsB).QueryValues(map[string][]string{"token": {"secret"}}).BodyForm(paramsB).ReceiveSuccess(model)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if model.FavoriteCount != 24 {
+		t.Errorf("expected response to still be decoded, got %v", model)
+	}
+
+	entries := recorder.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	entry := entries[0]
+	if entry.Request.Method != "POST" {
+		t.Errorf("expected POST, got %s", entry.Request.Method)
+	}
+	if expected := server.URL + "/foo?count=25&kind_name=recent&token=REDACTED"; entry.Request.URL != expected {
+		t.Errorf("expected %s, got %s", expected, entry.Request.URL)
+	}
+	for _, header := range entry.Request.Headers {
+		if header.Name == "Authorization" && header.Value != redacted {
+			t.Errorf("expected Authorization to be redacted, got %s", header.Value)
+		}
+	}
+	if entry.Request.PostData == nil || entry.Request.PostData.Text != "count=25&kind_name=r" || entry.Request.PostData.Comment != harTruncated || len(entry.Request.PostData.Params) != 0 {
+		t.Errorf("unexpected post data %+v", entry.Request.PostData)
+	}
+	// only MaxBodySize bytes of the body are read, but its length is known
+	if entry.Request.BodySize != 25 {
+		t.Errorf("expected body size 25, got %d", entry.Request.BodySize)
+	}
+	if entry.Response.Status != 201 || entry.Response.StatusText != "Created" {
+		t.Errorf("expected 201 Created, got %d %s", entry.Response.Status, entry.Response.StatusText)
+	}
+	content := entry.Response.Content
+	if content.Size != 43 || content.Text != `{"text": "Some text"` || content.Comment != harTruncated {
+		t.Errorf("unexpected content %+v", content)
+	}
+	if entry.Timings.Send < 0 || entry.Timings.Wait < 0 || entry.Timings.Receive < 0 || entry.Time <= 0 {
+		t.Errorf("unexpected timings %+v", entry.Timings)
+	}
+	if entry.Timings.Connect < 0 {
+		t.Errorf("expected a new connection to record connect time, got %v", entry.Timings.Connect)
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := recorder.WriteTo(buf); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	var har HAR
+	if err := json.Unmarshal(buf.Bytes(), &har); err != nil {
+		t.Fatalf("expected valid HAR JSON, got %v", err)
+	}
+	if har.Log.Version != "1.2" || har.Log.Creator.Version == "" || len(har.Log.Entries) != 1 {
+		t.Errorf("unexpected HAR log %+v", har.Log)
+	}
+}
+
+func TestHARRecorder_entriesInFlight(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "body")
+	}))
+	defer server.Close()
+
+	recorder := NewHARRecorder()
+	resp, err := New().Get(server.URL).Use(recorder.Wrap).Do(context.Background())
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}()
+	// entries may be read while the response body is, without a race
+	entries := recorder.Entries()
+	text := entries[0].Response.Content.Text
+	<-done
+	if text != "" && text != "body" {
+		t.Errorf("unexpected entry body %q", text)
+	}
+	if text := recorder.Entries()[0].Response.Content.Text; text != "body" {
+		t.Errorf("expected the finished entry to have the body, got %q", text)
+	}
+}
+
+func TestHARRecorder_streamingBody(t *testing.T) {
+	var received int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = len(body)
+	}))
+	defer server.Close()
+
+	recorder := NewHARRecorder()
+	recorder.MaxBodySize = 10
+	// a body which can't be replayed is only read up to MaxBodySize before
+	// it is sent
+	body := &countingReader{r: strings.NewReader(strings.Repeat("a", 1<<20))}
+	readBeforeSend := -1
+	sent := func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			readBeforeSend = body.read
+			return next.Do(req)
+		})
+	}
+	resp, err := New().Post(server.URL).Use(recorder.Wrap, sent).Body(body).Do(context.Background())
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	resp.Body.Close()
+	if readBeforeSend != 11 {
+		t.Errorf("expected 11 bytes read before sending, got %d", readBeforeSend)
+	}
+	if received != 1<<20 {
+		t.Errorf("expected the whole body to be sent, got %d bytes", received)
+	}
+	entry := recorder.Entries()[0]
+	if postData := entry.Request.PostData; postData == nil || postData.Text != "aaaaaaaaaa" || postData.Comment != harTruncated {
+		t.Errorf("unexpected post data %+v", postData)
+	}
+	if entry.Request.BodySize != -1 {
+		t.Errorf("expected unknown body size, got %d", entry.Request.BodySize)
+	}
+}
+
+func TestHARRecorder_error(t *testing.T) {
+	expectedErr := errors.New("connection refused")
+	recorder := NewHARRecorder()
+	s := New().Doer(&fakeDoer{Err: expectedErr}).Use(recorder.Wrap)
+
+	_, err := s.Get("http://a.io/").ReceiveSuccess(&FakeModel{})
+	if !errors.Is(err, expectedErr) {
+		t.Errorf("expected %v, got %v", expectedErr, err)
+	}
+	entries := recorder.Entries()
+	if len(entries) != 1 || entries[0].Comment != expectedErr.Error() {
+		t.Errorf("expected failed exchange to be recorded, got %+v", entries)
+	}
+}
+
+func TestUse(t *testing.T) {
+	var order []string
+	middleware := func(name string) Middleware {
+		return func(next Doer) Doer {
+			return DoerFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				return next.Do(req)
+			})
+		}
+	}
+	resp := &http.Response{StatusCode: 204, Body: http.NoBody}
+	parent := New().Doer(&fakeDoer{Response: resp}).Use(middleware("a"))
+	child := parent.New().Use(middleware("b"), nil)
+
+	if _, err := child.Get("http://a.io/").ReceiveSuccess(&FakeModel{}); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if fmt.Sprint(order) != "[a b]" {
+		t.Errorf("expected [a b], got %v", order)
+	}
+	if len(parent.middleware) != 1 {
+		t.Errorf("child Use should not mutate parent middleware")
+	}
+}
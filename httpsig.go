@@ -0,0 +1,697 @@
+package sling
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTP message signature algorithms (RFC 9421 section 3.3).
+const (
+	SignatureHMACSHA256       = "hmac-sha256"
+	SignatureRSAPSSSHA512     = "rsa-pss-sha512"
+	SignatureRSAV15SHA256     = "rsa-v1_5-sha256"
+	SignatureECDSAP256SHA256  = "ecdsa-p256-sha256"
+	SignatureECDSAP384SHA384  = "ecdsa-p384-sha384"
+	SignatureEd25519          = "ed25519"
+	defaultSignatureLabel     = "sig1"
+	signatureInputHeader      = "Signature-Input"
+	signatureHeader           = "Signature"
+	signatureParamsIdentifier = `"@signature-params"`
+)
+
+// SignatureError is returned when a message signature is missing or does
+// not verify.
+type SignatureError struct {
+	Label  string
+	Reason string
+}
+
+func (e *SignatureError) Error() string {
+	if e.Label == "" {
+		return "httpsig: " + e.Reason
+	}
+	return fmt.Sprintf("httpsig: signature %q: %s", e.Label, e.Reason)
+}
+
+// MessageSigner signs requests with HTTP Message Signatures (RFC 9421),
+// setting the Signature-Input and Signature headers. Add it to a Sling with
+// Signer. For example,
+//
+//	signer := &sling.MessageSigner{
+//	    Components: []string{"@method", "@target-uri", "content-digest"},
+//	    KeyID:      "partner-key",
+//	    Algorithm:  sling.SignatureEd25519,
+//	    Key:        privateKey,
+//	}
+//	s := sling.New().Signer(signer)
+type MessageSigner struct {
+	// Label of the signature, by default "sig1".
+	Label string
+	// Components are the covered component identifiers: derived components
+	// such as "@method", "@target-uri", "@authority", "@path", "@query" or
+	// `@query-param;name="id"`, and lowercase header names such as
+	// "content-digest" or "content-type".
+	Components []string
+	KeyID      string
+	// Algorithm is one of the Signature* algorithms.
+	Algorithm string
+	// Key is a []byte secret for hmac-sha256, an *rsa.PrivateKey for RSA
+	// algorithms, an *ecdsa.PrivateKey for ECDSA algorithms or an
+	// ed25519.PrivateKey. Other crypto.Signers holding such keys may be used.
+	Key interface{}
+	// Expires, if non-zero, sets the expires parameter that long after
+	// created.
+	Expires time.Duration
+	// Tag sets the tag parameter, naming the application of the signature.
+	Tag string
+	// Nonce adds a random nonce parameter.
+	Nonce bool
+	// OmitAlg leaves out the alg parameter, for verifiers which derive the
+	// algorithm from the key ID.
+	OmitAlg bool
+}
+
+// signatureNow returns the time messages are signed and verified at.
+var signatureNow = time.Now
+
+// Sign signs the request, adding to any existing signatures.
+func (m *MessageSigner) Sign(req *http.Request) error {
+	label := m.Label
+	if label == "" {
+		label = defaultSignatureLabel
+	}
+	ids := make([]componentID, len(m.Components))
+	for i, component := range m.Components {
+		id, err := parseComponentID(component)
+		if err != nil {
+			return err
+		}
+		ids[i] = id
+	}
+
+	now := signatureNow()
+	params := fmt.Sprintf(";created=%d", now.Unix())
+	if m.Expires > 0 {
+		params += fmt.Sprintf(";expires=%d", now.Add(m.Expires).Unix())
+	}
+	if m.Nonce {
+		nonce, err := randomID()
+		if err != nil {
+			return err
+		}
+		params += fmt.Sprintf(";nonce=%q", nonce)
+	}
+	if !m.OmitAlg {
+		params += fmt.Sprintf(";alg=%q", m.Algorithm)
+	}
+	if m.KeyID != "" {
+		params += fmt.Sprintf(";keyid=%q", m.KeyID)
+	}
+	if m.Tag != "" {
+		params += fmt.Sprintf(";tag=%q", m.Tag)
+	}
+
+	signatureParams := serializeComponentIDs(ids) + params
+	base, err := signatureBase(message{req: req}, ids, signatureParams)
+	if err != nil {
+		return err
+	}
+	sig, err := signMessage(m.Algorithm, m.Key, []byte(base))
+	if err != nil {
+		return err
+	}
+	req.Header.Add(signatureInputHeader, label+"="+signatureParams)
+	req.Header.Add(signatureHeader, label+"=:"+base64.StdEncoding.EncodeToString(sig)+":")
+	return nil
+}
+
+// VerificationKey is a key trusted to verify message signatures.
+type VerificationKey struct {
+	// Algorithm is one of the Signature* algorithms. A signature whose alg
+	// parameter names another algorithm is rejected.
+	Algorithm string
+	// Key is a []byte secret for hmac-sha256, an *rsa.PublicKey, an
+	// *ecdsa.PublicKey or an ed25519.PublicKey.
+	Key interface{}
+}
+
+// MessageVerifier verifies HTTP Message Signatures (RFC 9421) of responses,
+// or of requests received by webhook handlers. Use Wrap as a Sling
+// Middleware to reject responses which aren't signed by a trusted key.
+type MessageVerifier struct {
+	// Keys are the trusted keys by key ID.
+	Keys map[string]VerificationKey
+	// Label selects the signature to verify. If empty, any signature with a
+	// trusted key ID is verified.
+	Label string
+	// Required components must be covered by the signature, such as
+	// "@status" and "content-digest" for responses.
+	Required []string
+	// MaxAge, if non-zero, rejects signatures created longer ago.
+	MaxAge time.Duration
+}
+
+// VerifyRequest verifies a signature of the request.
+func (v *MessageVerifier) VerifyRequest(req *http.Request) error {
+	return v.verify(message{req: req, header: req.Header})
+}
+
+// VerifyResponse verifies a signature of the response. Components with the
+// req parameter are taken from resp.Request. Derived components of the
+// request, such as "@method", must have it.
+func (v *MessageVerifier) VerifyResponse(resp *http.Response) error {
+	return v.verify(message{req: resp.Request, resp: resp, header: resp.Header})
+}
+
+// Wrap returns a Doer which returns a *SignatureError, and closes the
+// response body, when a response from next fails verification.
+func (v *MessageVerifier) Wrap(next Doer) Doer {
+	return DoerFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := next.Do(req)
+		if err != nil {
+			return resp, err
+		}
+		if resp.Request == nil {
+			resp.Request = req
+		}
+		if err := v.VerifyResponse(resp); err != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			return nil, err
+		}
+		return resp, nil
+	})
+}
+
+func (v *MessageVerifier) verify(msg message) error {
+	inputs, err := parseSignatureInputs(msg.header.Values(signatureInputHeader))
+	if err != nil {
+		return &SignatureError{Reason: err.Error()}
+	}
+	signatures, err := parseByteSequences(msg.header.Values(signatureHeader))
+	if err != nil {
+		return &SignatureError{Reason: "invalid Signature header: " + err.Error()}
+	}
+
+	var lastErr error = &SignatureError{Label: v.Label, Reason: "no signature with a trusted key"}
+	for _, input := range inputs {
+		if v.Label != "" && input.label != v.Label {
+			continue
+		}
+		if _, ok := v.Keys[input.keyID]; !ok {
+			continue
+		}
+		err := v.verifyInput(msg, input, signatures[input.label])
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+	}
+	return lastErr
+}
+
+func (v *MessageVerifier) verifyInput(msg message, input signatureInput, sig []byte) error {
+	fail := func(format string, args ...interface{}) error {
+		return &SignatureError{Label: input.label, Reason: fmt.Sprintf(format, args...)}
+	}
+	if sig == nil {
+		return fail("missing Signature header")
+	}
+	key := v.Keys[input.keyID]
+	if input.alg != "" && input.alg != key.Algorithm {
+		return fail("algorithm %q does not match key %q", input.alg, input.keyID)
+	}
+
+	covered := make(map[string]bool, len(input.components))
+	for _, id := range input.components {
+		covered[id.String()] = true
+	}
+	for _, required := range v.Required {
+		id, err := parseComponentID(required)
+		if err != nil {
+			return err
+		}
+		if !covered[id.String()] {
+			return fail("required component %s is not covered", id)
+		}
+	}
+
+	now := signatureNow()
+	if input.expires > 0 && now.Unix() > input.expires {
+		return fail("expired")
+	}
+	if v.MaxAge > 0 && input.created > 0 && now.Sub(time.Unix(input.created, 0)) > v.MaxAge {
+		return fail("created too long ago")
+	}
+
+	base, err := signatureBase(msg, input.components, input.params)
+	if err != nil {
+		return fail("%v", err)
+	}
+	if err := verifyMessage(key.Algorithm, key.Key, []byte(base), sig); err != nil {
+		return fail("%v", err)
+	}
+	return nil
+}
+
+// HMACSigner signs request bodies with HMAC-SHA256 in a single header, as
+// used by many webhook style APIs, for example
+// "X-Signature: sha256=<hex HMAC of the body>". When TimestampHeader is
+// set, the current Unix time is sent in that header and the signed content
+// is "<timestamp>.<body>".
+type HMACSigner struct {
+	Key []byte
+	// Header carrying the signature, by default "X-Signature".
+	Header string
+	// Prefix of the signature value, such as "sha256=".
+	Prefix string
+	// Base64 encodes the signature with standard base64 instead of hex.
+	Base64 bool
+	// TimestampHeader, if set, carries the signed Unix timestamp.
+	TimestampHeader string
+}
+
+// Sign signs the request body.
+func (h *HMACSigner) Sign(req *http.Request) error {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, h.Key)
+	if h.TimestampHeader != "" {
+		timestamp := strconv.FormatInt(signatureNow().Unix(), 10)
+		req.Header.Set(h.TimestampHeader, timestamp)
+		mac.Write([]byte(timestamp + "."))
+	}
+	mac.Write(body)
+
+	sum := mac.Sum(nil)
+	sig := hex.EncodeToString(sum)
+	if h.Base64 {
+		sig = base64.StdEncoding.EncodeToString(sum)
+	}
+	header := h.Header
+	if header == "" {
+		header = "X-Signature"
+	}
+	req.Header.Set(header, h.Prefix+sig)
+	return nil
+}
+
+// message is a request, or a response and the request which caused it,
+// whose components are signed.
+type message struct {
+	req    *http.Request
+	resp   *http.Response
+	header http.Header
+}
+
+// componentID is a covered component identifier with its parameters.
+type componentID struct {
+	name string
+	// name parameter of @query-param
+	param string
+	// req parameter, taking the component from the request of a response
+	req bool
+}
+
+func (id componentID) String() string {
+	s := strconv.Quote(id.name)
+	if id.param != "" {
+		s += ";name=" + strconv.Quote(id.param)
+	}
+	if id.req {
+		s += ";req"
+	}
+	return s
+}
+
+// parseComponentID parses an identifier such as `@query-param;name="id"`,
+// with or without quotes around the component name.
+func parseComponentID(s string) (componentID, error) {
+	parts := strings.Split(s, ";")
+	id := componentID{name: strings.ToLower(strings.Trim(strings.TrimSpace(parts[0]), `"`))}
+	if id.name == "" {
+		return id, fmt.Errorf("httpsig: empty component identifier")
+	}
+	for _, param := range parts[1:] {
+		key, value := param, ""
+		if eq := strings.IndexByte(param, '='); eq >= 0 {
+			key, value = param[:eq], strings.Trim(param[eq+1:], `"`)
+		}
+		switch key {
+		case "req":
+			id.req = true
+		case "name":
+			id.param = value
+		default:
+			return id, fmt.Errorf("httpsig: unsupported component parameter %q", key)
+		}
+	}
+	if id.name == "@query-param" && id.param == "" {
+		return id, fmt.Errorf("httpsig: @query-param requires a name parameter")
+	}
+	return id, nil
+}
+
+func serializeComponentIDs(ids []componentID) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = id.String()
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+// signatureBase builds the signature base (RFC 9421 section 2.5).
+func signatureBase(msg message, ids []componentID, signatureParams string) (string, error) {
+	var b strings.Builder
+	for _, id := range ids {
+		value, err := componentValue(msg, id)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(id.String() + ": " + value + "\n")
+	}
+	b.WriteString(signatureParamsIdentifier + ": " + signatureParams)
+	return b.String(), nil
+}
+
+// componentValue returns the value of a component of the message.
+func componentValue(msg message, id componentID) (string, error) {
+	req, header := msg.req, msg.header
+	if header == nil && req != nil {
+		header = req.Header
+	}
+	if id.req || (msg.resp == nil && strings.HasPrefix(id.name, "@")) {
+		if req == nil {
+			return "", fmt.Errorf("httpsig: component %s requires the request", id)
+		}
+		header = req.Header
+	}
+
+	if !strings.HasPrefix(id.name, "@") {
+		values := header.Values(id.name)
+		if len(values) == 0 && id.name == "content-length" && req != nil && (msg.resp == nil || id.req) && req.ContentLength > 0 {
+			values = []string{strconv.FormatInt(req.ContentLength, 10)}
+		}
+		if len(values) == 0 && id.name == "host" && req != nil {
+			values = []string{requestHost(req)}
+		}
+		if len(values) == 0 {
+			return "", fmt.Errorf("httpsig: covered header %q is missing", id.name)
+		}
+		for i, value := range values {
+			values[i] = strings.TrimSpace(value)
+		}
+		return strings.Join(values, ", "), nil
+	}
+
+	if id.name == "@status" {
+		if msg.resp == nil || id.req {
+			return "", fmt.Errorf("httpsig: @status is only defined for responses")
+		}
+		return strconv.Itoa(msg.resp.StatusCode), nil
+	}
+	if msg.resp != nil && !id.req {
+		// components of a response's request must be marked (RFC 9421
+		// section 2.4)
+		return "", fmt.Errorf("httpsig: component %s of a response requires the req parameter", id)
+	}
+
+	u := req.URL
+	switch id.name {
+	case "@method":
+		return req.Method, nil
+	case "@target-uri":
+		target := *u
+		if target.Host == "" {
+			target.Host = requestHost(req)
+		}
+		if target.Scheme == "" {
+			target.Scheme = requestScheme(req)
+		}
+		return target.String(), nil
+	case "@authority":
+		return strings.ToLower(requestHost(req)), nil
+	case "@scheme":
+		return requestScheme(req), nil
+	case "@request-target":
+		return u.RequestURI(), nil
+	case "@path":
+		if p := u.EscapedPath(); p != "" {
+			return p, nil
+		}
+		return "/", nil
+	case "@query":
+		return "?" + u.RawQuery, nil
+	case "@query-param":
+		values, err := url.ParseQuery(u.RawQuery)
+		if err != nil {
+			return "", err
+		}
+		value, ok := values[id.param]
+		if !ok {
+			return "", fmt.Errorf("httpsig: query parameter %q is missing", id.param)
+		}
+		return strings.ReplaceAll(url.QueryEscape(value[0]), "+", "%20"), nil
+	}
+	return "", fmt.Errorf("httpsig: unsupported derived component %s", id.name)
+}
+
+func requestHost(req *http.Request) string {
+	if req.Host != "" {
+		return req.Host
+	}
+	return req.URL.Host
+}
+
+func requestScheme(req *http.Request) string {
+	if req.URL.Scheme != "" {
+		return strings.ToLower(req.URL.Scheme)
+	}
+	if req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// signatureInput is a parsed Signature-Input dictionary member.
+type signatureInput struct {
+	label      string
+	components []componentID
+	// params is the serialized inner list and parameters, as signed
+	params  string
+	keyID   string
+	alg     string
+	created int64
+	expires int64
+}
+
+// parseSignatureInputs parses Signature-Input header values. Only the
+// structured field syntax used by signature inputs is supported.
+func parseSignatureInputs(values []string) ([]signatureInput, error) {
+	var inputs []signatureInput
+	for _, member := range splitDictionary(strings.Join(values, ", ")) {
+		eq := strings.IndexByte(member, '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("invalid Signature-Input member %q", member)
+		}
+		input := signatureInput{label: strings.TrimSpace(member[:eq]), params: strings.TrimSpace(member[eq+1:])}
+		if !strings.HasPrefix(input.params, "(") {
+			return nil, fmt.Errorf("invalid Signature-Input member %q", member)
+		}
+		end := strings.IndexByte(input.params, ')')
+		if end < 0 {
+			return nil, fmt.Errorf("invalid Signature-Input member %q", member)
+		}
+		for _, item := range strings.Fields(input.params[1:end]) {
+			id, err := parseComponentID(item)
+			if err != nil {
+				return nil, err
+			}
+			input.components = append(input.components, id)
+		}
+		for _, param := range strings.Split(input.params[end+1:], ";") {
+			eq := strings.IndexByte(param, '=')
+			if eq < 0 {
+				continue
+			}
+			key, value := param[:eq], param[eq+1:]
+			switch key {
+			case "keyid":
+				input.keyID = strings.Trim(value, `"`)
+			case "alg":
+				input.alg = strings.Trim(value, `"`)
+			case "created":
+				input.created, _ = strconv.ParseInt(value, 10, 64)
+			case "expires":
+				input.expires, _ = strconv.ParseInt(value, 10, 64)
+			}
+		}
+		inputs = append(inputs, input)
+	}
+	return inputs, nil
+}
+
+// parseByteSequences parses a structured field dictionary of byte
+// sequences, such as Signature or Content-Digest header values.
+func parseByteSequences(values []string) (map[string][]byte, error) {
+	sequences := map[string][]byte{}
+	for _, member := range splitDictionary(strings.Join(values, ", ")) {
+		eq := strings.IndexByte(member, '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("invalid member %q", member)
+		}
+		value := strings.TrimSpace(member[eq+1:])
+		if len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+			return nil, fmt.Errorf("invalid member %q", member)
+		}
+		b, err := base64.StdEncoding.DecodeString(value[1 : len(value)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid member %q: %w", member, err)
+		}
+		sequences[strings.TrimSpace(member[:eq])] = b
+	}
+	return sequences, nil
+}
+
+// splitDictionary splits a structured field dictionary on commas which are
+// outside of strings and inner lists.
+func splitDictionary(s string) []string {
+	var members []string
+	depth, inString, start := 0, false, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && inString:
+			i++
+		case c == '"':
+			inString = !inString
+		case c == '(' && !inString:
+			depth++
+		case c == ')' && !inString:
+			depth--
+		case c == ',' && !inString && depth == 0:
+			members = append(members, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		members = append(members, last)
+	}
+	return members
+}
+
+// signMessage signs the signature base with the algorithm.
+func signMessage(alg string, key interface{}, base []byte) ([]byte, error) {
+	if alg == SignatureHMACSHA256 {
+		secret, ok := key.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("httpsig: %s requires a []byte key, got %T", alg, key)
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(base)
+		return mac.Sum(nil), nil
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("httpsig: %s requires a crypto.Signer key, got %T", alg, key)
+	}
+	switch alg {
+	case SignatureEd25519:
+		return signer.Sign(rand.Reader, base, crypto.Hash(0))
+	case SignatureRSAPSSSHA512:
+		digest := sha512.Sum512(base)
+		return signer.Sign(rand.Reader, digest[:], &rsa.PSSOptions{SaltLength: 64, Hash: crypto.SHA512})
+	case SignatureRSAV15SHA256:
+		digest := sha256.Sum256(base)
+		return signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	case SignatureECDSAP256SHA256:
+		digest := sha256.Sum256(base)
+		der, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+		if err != nil {
+			return nil, err
+		}
+		return ecdsaRawSignature(der, 32)
+	case SignatureECDSAP384SHA384:
+		digest := sha512.Sum384(base)
+		der, err := signer.Sign(rand.Reader, digest[:], crypto.SHA384)
+		if err != nil {
+			return nil, err
+		}
+		return ecdsaRawSignature(der, 48)
+	}
+	return nil, fmt.Errorf("httpsig: unsupported algorithm %q", alg)
+}
+
+// verifyMessage verifies the signature of the signature base.
+func verifyMessage(alg string, key interface{}, base, sig []byte) error {
+	invalid := fmt.Errorf("invalid signature")
+	switch alg {
+	case SignatureHMACSHA256:
+		expected, err := signMessage(alg, key, base)
+		if err != nil {
+			return err
+		}
+		if !hmac.Equal(expected, sig) {
+			return invalid
+		}
+		return nil
+	case SignatureEd25519:
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("%s requires an ed25519.PublicKey, got %T", alg, key)
+		}
+		if !ed25519.Verify(pub, base, sig) {
+			return invalid
+		}
+		return nil
+	case SignatureRSAPSSSHA512, SignatureRSAV15SHA256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%s requires an *rsa.PublicKey, got %T", alg, key)
+		}
+		if alg == SignatureRSAPSSSHA512 {
+			digest := sha512.Sum512(base)
+			return rsa.VerifyPSS(pub, crypto.SHA512, digest[:], sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto, Hash: crypto.SHA512})
+		}
+		digest := sha256.Sum256(base)
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig)
+	case SignatureECDSAP256SHA256, SignatureECDSAP384SHA384:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%s requires an *ecdsa.PublicKey, got %T", alg, key)
+		}
+		var digest []byte
+		if alg == SignatureECDSAP256SHA256 {
+			sum := sha256.Sum256(base)
+			digest = sum[:]
+		} else {
+			sum := sha512.Sum384(base)
+			digest = sum[:]
+		}
+		size := len(sig) / 2
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		if len(sig)%2 != 0 || !ecdsa.Verify(pub, digest, r, s) {
+			return invalid
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported algorithm %q", alg)
+}
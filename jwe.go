@@ -0,0 +1,427 @@
+package sling
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const joseContentType = "application/jose"
+
+// jweHeader is the protected header of a JWE.
+type jweHeader struct {
+	Alg string `json:"alg"`
+	Enc string `json:"enc"`
+	Kid string `json:"kid,omitempty"`
+	Cty string `json:"cty,omitempty"`
+	Epk *JWK   `json:"epk,omitempty"`
+	// Apu and Apv are the base64url agreement PartyUInfo and PartyVInfo of
+	// ECDH-ES.
+	Apu string `json:"apu,omitempty"`
+	Apv string `json:"apv,omitempty"`
+	Zip string `json:"zip,omitempty"`
+}
+
+// JWEEncrypter encrypts content as JSON Web Encryption (RFC 7516) compact
+// serializations with A256GCM content encryption.
+type JWEEncrypter struct {
+	// Algorithm is the key management algorithm: RSA-OAEP-256 or ECDH-ES.
+	Algorithm string
+	// Key is the recipient's public key, an *rsa.PublicKey for RSA-OAEP-256
+	// or an *ecdsa.PublicKey or *ecdh.PublicKey on P-256, P-384 or P-521 for
+	// ECDH-ES.
+	Key crypto.PublicKey
+	// KeyID is set as the "kid" header, if non-empty.
+	KeyID string
+	// KeyFunc, if non-nil, returns the recipient's current key and key ID
+	// for each encryption instead of Key and KeyID, so keys can be rotated.
+	KeyFunc func() (keyID string, key crypto.PublicKey, err error)
+}
+
+// Encrypt returns the compact serialization of the encrypted plaintext. The
+// contentType, if non-empty, is set as the "cty" header.
+func (e *JWEEncrypter) Encrypt(plaintext []byte, contentType string) (string, error) {
+	keyID, key := e.KeyID, e.Key
+	if e.KeyFunc != nil {
+		var err error
+		if keyID, key, err = e.KeyFunc(); err != nil {
+			return "", err
+		}
+	}
+	header := jweHeader{Alg: e.Algorithm, Enc: "A256GCM", Kid: keyID, Cty: strings.TrimPrefix(contentType, "application/")}
+	if strings.Contains(header.Cty, "/") {
+		header.Cty = contentType
+	}
+
+	var cek, encryptedKey []byte
+	switch e.Algorithm {
+	case "RSA-OAEP-256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return "", fmt.Errorf("jwe: RSA-OAEP-256 requires an *rsa.PublicKey, got %T", key)
+		}
+		cek = make([]byte, 32)
+		if _, err := rand.Read(cek); err != nil {
+			return "", err
+		}
+		var err error
+		if encryptedKey, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, cek, nil); err != nil {
+			return "", err
+		}
+	case "ECDH-ES":
+		pub, err := ecdhPublicKey(key)
+		if err != nil {
+			return "", err
+		}
+		ephemeral, err := pub.Curve().GenerateKey(rand.Reader)
+		if err != nil {
+			return "", err
+		}
+		z, err := ephemeral.ECDH(pub)
+		if err != nil {
+			return "", err
+		}
+		epk, err := ecdhJWK(ephemeral.PublicKey())
+		if err != nil {
+			return "", err
+		}
+		header.Epk = &epk
+		cek = concatKDF(z, header.Enc, nil, nil, 32)
+	default:
+		return "", fmt.Errorf("jwe: unsupported algorithm %q", e.Algorithm)
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	protected := b64(headerJSON)
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nil, iv, plaintext, []byte(protected))
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+	return strings.Join([]string{protected, b64(encryptedKey), b64(iv), b64(ciphertext), b64(tag)}, "."), nil
+}
+
+// JWEDecrypter decrypts JSON Web Encryption compact serializations
+// encrypted with RSA-OAEP-256 or ECDH-ES and A256GCM or A128GCM.
+type JWEDecrypter struct {
+	// Key is the private key, an *rsa.PrivateKey, *ecdsa.PrivateKey or
+	// *ecdh.PrivateKey.
+	Key crypto.PrivateKey
+	// KeyFunc, if non-nil, returns the private key for the "kid" header
+	// instead of Key, so keys can be rotated.
+	KeyFunc func(keyID string) (crypto.PrivateKey, error)
+}
+
+// Decrypt returns the plaintext of the compact serialization.
+func (d *JWEDecrypter) Decrypt(token string) ([]byte, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("jwe: invalid compact serialization")
+	}
+	decoded := make([][]byte, 5)
+	for i, part := range parts {
+		b, err := base64.RawURLEncoding.DecodeString(part)
+		if err != nil {
+			return nil, fmt.Errorf("jwe: invalid compact serialization: %w", err)
+		}
+		decoded[i] = b
+	}
+	var header jweHeader
+	if err := json.Unmarshal(decoded[0], &header); err != nil {
+		return nil, fmt.Errorf("jwe: invalid header: %w", err)
+	}
+	if header.Zip != "" {
+		return nil, fmt.Errorf("jwe: unsupported compression %q", header.Zip)
+	}
+	var keySize int
+	switch header.Enc {
+	case "A256GCM":
+		keySize = 32
+	case "A128GCM":
+		keySize = 16
+	default:
+		return nil, fmt.Errorf("jwe: unsupported encryption %q", header.Enc)
+	}
+
+	key := d.Key
+	if d.KeyFunc != nil {
+		var err error
+		if key, err = d.KeyFunc(header.Kid); err != nil {
+			return nil, err
+		}
+	}
+
+	var cek []byte
+	switch header.Alg {
+	case "RSA-OAEP-256":
+		priv, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("jwe: RSA-OAEP-256 requires an *rsa.PrivateKey, got %T", key)
+		}
+		var err error
+		if cek, err = rsa.DecryptOAEP(sha256.New(), nil, priv, decoded[1], nil); err != nil {
+			return nil, fmt.Errorf("jwe: could not decrypt key: %w", err)
+		}
+		if len(cek) != keySize {
+			return nil, fmt.Errorf("jwe: invalid content encryption key size")
+		}
+	case "ECDH-ES":
+		priv, err := ecdhPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if header.Epk == nil {
+			return nil, fmt.Errorf("jwe: ECDH-ES header has no epk")
+		}
+		epk, err := header.Epk.ecdhPublicKey(priv.Curve())
+		if err != nil {
+			return nil, err
+		}
+		z, err := priv.ECDH(epk)
+		if err != nil {
+			return nil, err
+		}
+		apu, err := base64.RawURLEncoding.DecodeString(header.Apu)
+		if err != nil {
+			return nil, fmt.Errorf("jwe: invalid apu: %w", err)
+		}
+		apv, err := base64.RawURLEncoding.DecodeString(header.Apv)
+		if err != nil {
+			return nil, fmt.Errorf("jwe: invalid apv: %w", err)
+		}
+		cek = concatKDF(z, header.Enc, apu, apv, keySize)
+	default:
+		return nil, fmt.Errorf("jwe: unsupported algorithm %q", header.Alg)
+	}
+
+	gcm, err := newGCM(cek)
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded[2]) != gcm.NonceSize() {
+		return nil, fmt.Errorf("jwe: invalid initialization vector")
+	}
+	plaintext, err := gcm.Open(nil, decoded[2], append(decoded[3], decoded[4]...), []byte(parts[0]))
+	if err != nil {
+		return nil, fmt.Errorf("jwe: could not decrypt content: %w", err)
+	}
+	return plaintext, nil
+}
+
+// JWEBody returns a BodyProvider which encrypts the body of another provider
+// as a JWE compact serialization, with the application/jose Content-Type.
+// The provider's Content-Type is set as the "cty" header.
+func JWEBody(encrypter *JWEEncrypter, body BodyProvider) BodyProvider {
+	return jweBodyProvider{encrypter: encrypter, body: body}
+}
+
+// EncryptBody encrypts the Sling's current body as a JWE compact
+// serialization. Set the body first, for example
+//
+//	s.BodyJSON(payload).EncryptBody(encrypter)
+func (s *Sling) EncryptBody(encrypter *JWEEncrypter) *Sling {
+	if s.bodyProvider == nil {
+		return s
+	}
+	return s.BodyProvider(JWEBody(encrypter, s.bodyProvider))
+}
+
+// jweBodyProvider encrypts the body of another provider.
+type jweBodyProvider struct {
+	encrypter *JWEEncrypter
+	body      BodyProvider
+}
+
+func (p jweBodyProvider) ContentType() string {
+	return joseContentType
+}
+
+func (p jweBodyProvider) Body() (io.Reader, error) {
+	body, err := p.body.Body()
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	token, err := p.encrypter.Encrypt(plaintext, p.body.ContentType())
+	if err != nil {
+		return nil, err
+	}
+	return strings.NewReader(token), nil
+}
+
+// JWEDecoder decrypts JWE compact serialization response bodies, then
+// decodes the plaintext with Decoder, or as JSON if it is nil. Successful
+// (2XX) responses must be encrypted. Other responses are decoded as they
+// are unless they are encrypted, since servers often return errors in plain
+// text. Bodies are taken to be encrypted if their Content-Type is
+// application/jose or they are a compact serialization.
+type JWEDecoder struct {
+	Decrypter *JWEDecrypter
+	Decoder   ResponseDecoder
+}
+
+// Decode decrypts the Response Body and decodes the plaintext into the value
+// pointed to by v.
+func (d JWEDecoder) Decode(resp *http.Response, v interface{}) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if isSuccessful(resp.StatusCode) || isJWE(resp, body) {
+		if body, err = d.Decrypter.Decrypt(string(body)); err != nil {
+			return err
+		}
+	}
+
+	decoder := d.Decoder
+	if decoder == nil {
+		decoder = jsonDecoder{}
+	}
+	plain := *resp
+	plain.Body = io.NopCloser(bytes.NewReader(body))
+	plain.ContentLength = int64(len(body))
+	return decoder.Decode(&plain, v)
+}
+
+// isJWE reports whether a response body is encrypted: its Content-Type is
+// application/jose or it is five base64url segments, as a compact
+// serialization is.
+func isJWE(resp *http.Response, body []byte) bool {
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get(contentType)); err == nil && mediaType == joseContentType {
+		return true
+	}
+	segments := bytes.Split(bytes.TrimSpace(body), []byte("."))
+	if len(segments) != 5 {
+		return false
+	}
+	for _, segment := range segments {
+		for _, c := range segment {
+			if !('A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// newGCM returns AES-GCM with the content encryption key.
+func newGCM(cek []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// concatKDF derives a key from the ECDH-ES shared secret with the Concat
+// KDF of NIST SP 800-56A, as specified by RFC 7518 section 4.6.2.
+func concatKDF(z []byte, algorithm string, apu, apv []byte, keySize int) []byte {
+	lengthPrefixed := func(b []byte) []byte {
+		return append(binary.BigEndian.AppendUint32(nil, uint32(len(b))), b...)
+	}
+	var otherInfo []byte
+	otherInfo = append(otherInfo, lengthPrefixed([]byte(algorithm))...)
+	otherInfo = append(otherInfo, lengthPrefixed(apu)...)
+	otherInfo = append(otherInfo, lengthPrefixed(apv)...)
+	otherInfo = binary.BigEndian.AppendUint32(otherInfo, uint32(keySize*8))
+
+	var key []byte
+	for counter := uint32(1); len(key) < keySize; counter++ {
+		h := sha256.New()
+		h.Write(binary.BigEndian.AppendUint32(nil, counter))
+		h.Write(z)
+		h.Write(otherInfo)
+		key = h.Sum(key)
+	}
+	return key[:keySize]
+}
+
+// ecdhPublicKey converts an ECDSA or ECDH public key to an ECDH key.
+func ecdhPublicKey(key crypto.PublicKey) (*ecdh.PublicKey, error) {
+	switch k := key.(type) {
+	case *ecdh.PublicKey:
+		return k, nil
+	case *ecdsa.PublicKey:
+		return k.ECDH()
+	}
+	return nil, fmt.Errorf("jwe: ECDH-ES requires an *ecdsa.PublicKey or *ecdh.PublicKey, got %T", key)
+}
+
+// ecdhPrivateKey converts an ECDSA or ECDH private key to an ECDH key.
+func ecdhPrivateKey(key crypto.PrivateKey) (*ecdh.PrivateKey, error) {
+	switch k := key.(type) {
+	case *ecdh.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		return k.ECDH()
+	}
+	return nil, fmt.Errorf("jwe: ECDH-ES requires an *ecdsa.PrivateKey or *ecdh.PrivateKey, got %T", key)
+}
+
+// ecdhCurves maps JWK curve names to ECDH curves.
+var ecdhCurves = map[string]ecdh.Curve{
+	"P-256": ecdh.P256(),
+	"P-384": ecdh.P384(),
+	"P-521": ecdh.P521(),
+}
+
+// ecdhJWK returns the JWK of an ECDH public key on a NIST curve.
+func ecdhJWK(pub *ecdh.PublicKey) (JWK, error) {
+	for name, curve := range ecdhCurves {
+		if pub.Curve() != curve {
+			continue
+		}
+		// uncompressed point: 0x04 || x || y
+		point := pub.Bytes()
+		size := (len(point) - 1) / 2
+		return JWK{Kty: "EC", Crv: name, X: b64(point[1 : 1+size]), Y: b64(point[1+size:])}, nil
+	}
+	return JWK{}, fmt.Errorf("jwe: unsupported curve %v", pub.Curve())
+}
+
+// ecdhPublicKey returns the EC key as an ECDH public key on the curve. The
+// point is validated to be on the curve.
+func (k JWK) ecdhPublicKey(curve ecdh.Curve) (*ecdh.PublicKey, error) {
+	if k.Kty != "EC" || ecdhCurves[k.Crv] != curve {
+		return nil, fmt.Errorf("jwe: epk must be an EC key on the curve of the private key")
+	}
+	x, errX := base64.RawURLEncoding.DecodeString(k.X)
+	y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+	if errX != nil || errY != nil {
+		return nil, fmt.Errorf("jwe: invalid epk coordinates")
+	}
+	size := map[string]int{"P-256": 32, "P-384": 48, "P-521": 66}[k.Crv]
+	if len(x) > size || len(y) > size {
+		return nil, fmt.Errorf("jwe: invalid epk coordinates")
+	}
+	point := []byte{4}
+	point = append(point, new(big.Int).SetBytes(x).FillBytes(make([]byte, size))...)
+	point = append(point, new(big.Int).SetBytes(y).FillBytes(make([]byte, size))...)
+	return curve.NewPublicKey(point)
+}
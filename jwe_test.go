@@ -0,0 +1,227 @@
+package sling
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ECDH-ES keys of the RFC 7518 appendix C example.
+func rfc7518Key(t *testing.T, d, x, y string) *ecdh.PrivateKey {
+	raw, _ := base64.RawURLEncoding.DecodeString(d)
+	key, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, err := ecdhJWK(key.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jwk.X != x || jwk.Y != y {
+		t.Fatalf("expected public key %s %s, got %s %s", x, y, jwk.X, jwk.Y)
+	}
+	return key
+}
+
+func rfc7518Keys(t *testing.T) (alice, bob *ecdh.PrivateKey) {
+	alice = rfc7518Key(t, "0_NxaRPUMQoAJt50Gz8YiTr8gRTwyEaCumd-MToTmIo", "gI0GAILBdu7T53akrFmMyGcsF3n5dO7MmwNBHKW5SV0", "SLW_xSffzlPWrHEVI30DHM_4egVwt3NQqeUD7nMFpps")
+	bob = rfc7518Key(t, "VEmDZpDXXK8p8N0Cndsxs924q6nS1RXFASRl6BfUqdw", "weNJy2HscCSM6AEDTDg04biOvhFhyyWvOHQfeF_PxMQ", "e8lnCO-AlStT-NJVX-crhB7QRYhiix03illJOVAOyck")
+	return alice, bob
+}
+
+func TestConcatKDF_rfc7518(t *testing.T) {
+	alice, bob := rfc7518Keys(t)
+	z, err := alice.ECDH(bob.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := concatKDF(z, "A128GCM", []byte("Alice"), []byte("Bob"), 16)
+	if got := b64(key); got != "VqqN6vgjbSBcIijNcacQGg" {
+		t.Errorf("expected derived key VqqN6vgjbSBcIijNcacQGg, got %s", got)
+	}
+}
+
+func TestJWEDecrypter_partyInfo(t *testing.T) {
+	// the RFC 7518 appendix C example, whose apu and apv derive its key
+	alice, bob := rfc7518Keys(t)
+	epk, err := ecdhJWK(alice.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	headerJSON, _ := json.Marshal(jweHeader{Alg: "ECDH-ES", Enc: "A128GCM", Epk: &epk, Apu: "QWxpY2U", Apv: "Qm9i"})
+	header := b64(headerJSON)
+	cek, _ := base64.RawURLEncoding.DecodeString("VqqN6vgjbSBcIijNcacQGg")
+	gcm, err := newGCM(cek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iv := make([]byte, gcm.NonceSize())
+	sealed := gcm.Seal(nil, iv, []byte(`{"text":"secret"}`), []byte(header))
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+	token := strings.Join([]string{header, "", b64(iv), b64(ciphertext), b64(tag)}, ".")
+
+	plaintext, err := (&JWEDecrypter{Key: bob}).Decrypt(token)
+	if err != nil || string(plaintext) != `{"text":"secret"}` {
+		t.Errorf("expected plaintext, got %s %v", plaintext, err)
+	}
+}
+
+func TestJWE_roundTrip(t *testing.T) {
+	_, bob := rfc7518Keys(t)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		encrypter *JWEEncrypter
+		decrypter *JWEDecrypter
+	}{
+		{&JWEEncrypter{Algorithm: "RSA-OAEP-256", Key: &rsaKey.PublicKey}, &JWEDecrypter{Key: rsaKey}},
+		{&JWEEncrypter{Algorithm: "ECDH-ES", Key: bob.PublicKey(), KeyID: "bob"}, &JWEDecrypter{Key: bob}},
+	}
+	for _, c := range cases {
+		token, err := c.encrypter.Encrypt([]byte(`{"text":"secret"}`), jsonContentType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parts := strings.Split(token, "."); len(parts) != 5 || strings.Contains(token, "secret") {
+			t.Errorf("%s: expected an encrypted compact serialization, got %s", c.encrypter.Algorithm, token)
+		}
+		var header jweHeader
+		headerJSON, _ := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+		json.Unmarshal(headerJSON, &header)
+		if header.Alg != c.encrypter.Algorithm || header.Enc != "A256GCM" || header.Cty != "json" || header.Kid != c.encrypter.KeyID {
+			t.Errorf("%s: unexpected header %s", c.encrypter.Algorithm, headerJSON)
+		}
+
+		plaintext, err := c.decrypter.Decrypt(token)
+		if err != nil || string(plaintext) != `{"text":"secret"}` {
+			t.Errorf("%s: expected plaintext, got %s %v", c.encrypter.Algorithm, plaintext, err)
+		}
+
+		// tampering with any part fails
+		parts := strings.Split(token, ".")
+		for i := range parts {
+			if parts[i] == "" {
+				continue
+			}
+			tampered := append([]string{}, parts...)
+			raw, _ := base64.RawURLEncoding.DecodeString(tampered[i])
+			raw[len(raw)-1] ^= 1
+			tampered[i] = b64(raw)
+			if _, err := c.decrypter.Decrypt(strings.Join(tampered, ".")); err == nil {
+				t.Errorf("%s: expected tampered part %d to fail", c.encrypter.Algorithm, i)
+			}
+		}
+	}
+}
+
+func TestJWE_keyRotation(t *testing.T) {
+	alice, bob := rfc7518Keys(t)
+	keys := map[string]*ecdh.PrivateKey{"alice": alice, "bob": bob}
+	current := "alice"
+	encrypter := &JWEEncrypter{Algorithm: "ECDH-ES", KeyFunc: func() (string, crypto.PublicKey, error) {
+		return current, keys[current].PublicKey(), nil
+	}}
+	decrypter := &JWEDecrypter{KeyFunc: func(keyID string) (crypto.PrivateKey, error) {
+		key, ok := keys[keyID]
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", keyID)
+		}
+		return key, nil
+	}}
+
+	var tokens []string
+	for _, keyID := range []string{"alice", "bob"} {
+		current = keyID
+		token, err := encrypter.Encrypt([]byte("hello"), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, token)
+	}
+	for _, token := range tokens {
+		if plaintext, err := decrypter.Decrypt(token); err != nil || string(plaintext) != "hello" {
+			t.Errorf("expected tokens of rotated keys to decrypt, got %s %v", plaintext, err)
+		}
+	}
+	// a token for bob can't be decrypted with alice's key
+	if _, err := (&JWEDecrypter{Key: alice}).Decrypt(tokens[1]); err == nil {
+		t.Errorf("expected decryption with the wrong key to fail")
+	}
+}
+
+func TestJWE_sling(t *testing.T) {
+	_, server := rfc7518Keys(t)
+	client, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	toServer := &JWEEncrypter{Algorithm: "ECDH-ES", Key: server.PublicKey()}
+	toClient := &JWEEncrypter{Algorithm: "ECDH-ES", Key: client.PublicKey()}
+
+	var received string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		plaintext, err := (&JWEDecrypter{Key: server}).Decrypt(string(body))
+		if err != nil || r.Header.Get("Content-Type") != joseContentType {
+			w.WriteHeader(http.StatusBadRequest)
+			// a message with four dots isn't taken for a JWE
+			fmt.Fprint(w, `{"message": "Not encrypted. See docs. Retry later. Thanks."}`)
+			return
+		}
+		received = string(plaintext)
+		token, _ := toClient.Encrypt([]byte(`{"text": "reply"}`), jsonContentType)
+		w.Header().Set("Content-Type", joseContentType)
+		fmt.Fprint(w, token)
+	}))
+	defer ts.Close()
+
+	s := New().Base(ts.URL).ResponseDecoder(JWEDecoder{Decrypter: &JWEDecrypter{Key: client}})
+	model, apiErr := new(FakeModel), new(APIError)
+	if _, err := s.New().Post("/").BodyJSON(FakeModel{Text: "request"}).EncryptBody(toServer).Receive(model, apiErr); err != nil {
+		t.Fatal(err)
+	}
+	if received != "{\"text\":\"request\"}\n" || model.Text != "reply" {
+		t.Errorf("expected encrypted request and reply, got %q and %+v", received, model)
+	}
+
+	// plain error responses are decoded as they are
+	resp, err := s.New().Post("/").BodyJSON(FakeModel{Text: "request"}).Receive(model, apiErr)
+	if err != nil || resp.StatusCode != http.StatusBadRequest || apiErr.Message != "Not encrypted. See docs. Retry later. Thanks." {
+		t.Errorf("expected plain error response, got %v %+v", err, apiErr)
+	}
+}
+
+func TestIsJWE(t *testing.T) {
+	const token = "eyJhbGciOiJFQ0RILUVTIn0..48V1_ALb6US04U3b.5eym8TW_c8SuK0ltJ3rpYIzOeDQz7TALvtu6UG9oMo4vpzs9tX_EFShS8iB7j6ji.XFBoMYUZodetZdvTiFvSkQ"
+	cases := []struct {
+		contentType string
+		body        string
+		expected    bool
+	}{
+		{joseContentType, "not a token", true},
+		{joseContentType + "; charset=utf-8", token, true},
+		{"", token, true},
+		{"", token + "\n", true},
+		{jsonContentType, `{"message":"Bad input. See docs. Retry later. Thanks."}`, false},
+		{"text/plain", "Bad input. See docs. Retry later. Thanks", false},
+		{"", "a.b.c.d", false},
+	}
+	for _, c := range cases {
+		resp := &http.Response{Header: http.Header{}}
+		resp.Header.Set("Content-Type", c.contentType)
+		if got := isJWE(resp, []byte(c.body)); got != c.expected {
+			t.Errorf("%q %q: expected %v, got %v", c.contentType, c.body, c.expected, got)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package sling
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	_ "crypto/sha512" // register SHA-384 and SHA-512 for JWT signing
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// JWTSigner signs JSON Web Tokens (RFC 7519) with an RSA or ECDSA private key.
+type JWTSigner struct {
+	// Algorithm is the JWS algorithm: RS256, RS384, RS512, PS256, PS384,
+	// PS512, ES256, ES384 or ES512.
+	Algorithm string
+	// Key is an *rsa.PrivateKey for RS and PS algorithms or an
+	// *ecdsa.PrivateKey for ES algorithms. Other crypto.Signers holding such
+	// keys, such as keys in a KMS, may also be used.
+	Key crypto.Signer
+	// KeyID is set as the "kid" header, if non-empty, so the verifier can
+	// select the public key from its JWKS.
+	KeyID string
+	// JWKSURL is set as the "jku" header, if non-empty, so the verifier can
+	// fetch the JWKS containing the public key.
+	JWKSURL string
+}
+
+// Sign returns the compact serialization of a JWT with the JSON encoded
+// claims.
+func (j JWTSigner) Sign(claims interface{}) (string, error) {
+	hash, err := jwsHash(j.Algorithm)
+	if err != nil {
+		return "", err
+	}
+	if j.Key == nil {
+		return "", fmt.Errorf("jwt: no signing key")
+	}
+
+	header := map[string]string{"alg": j.Algorithm, "typ": "JWT"}
+	if j.KeyID != "" {
+		header["kid"] = j.KeyID
+	}
+	if j.JWKSURL != "" {
+		header["jku"] = j.JWKSURL
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := b64(headerJSON) + "." + b64(claimsJSON)
+
+	h := hash.New()
+	h.Write([]byte(signingInput))
+	digest := h.Sum(nil)
+
+	var opts crypto.SignerOpts = hash
+	if strings.HasPrefix(j.Algorithm, "PS") {
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash}
+	}
+	sig, err := j.Key.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.HasPrefix(j.Algorithm, "ES") {
+		pub, ok := j.Key.Public().(*ecdsa.PublicKey)
+		if !ok {
+			return "", fmt.Errorf("jwt: %s requires an ECDSA key", j.Algorithm)
+		}
+		sig, err = ecdsaRawSignature(sig, (pub.Curve.Params().BitSize+7)/8)
+		if err != nil {
+			return "", err
+		}
+	} else if _, ok := j.Key.Public().(*rsa.PublicKey); !ok {
+		return "", fmt.Errorf("jwt: %s requires an RSA key", j.Algorithm)
+	}
+
+	return signingInput + "." + b64(sig), nil
+}
+
+// JWK is a public JSON Web Key (RFC 7517) for an RSA or EC key.
+type JWK struct {
+	Kty    string   `json:"kty"`
+	Kid    string   `json:"kid,omitempty"`
+	Alg    string   `json:"alg,omitempty"`
+	Use    string   `json:"use,omitempty"`
+	KeyOps []string `json:"key_ops,omitempty"`
+	// RSA public key members
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC public key members
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set, as published for a client's keys.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWK returns the signer's public key as a JWK to publish in a JWKS.
+// The kid is the signer's KeyID, or the RFC 7638 thumbprint of the key if
+// KeyID is empty.
+func (j JWTSigner) PublicJWK() (JWK, error) {
+	if j.Key == nil {
+		return JWK{}, fmt.Errorf("jwt: no signing key")
+	}
+	var jwk JWK
+	switch pub := j.Key.Public().(type) {
+	case *rsa.PublicKey:
+		jwk = JWK{Kty: "RSA", N: b64(pub.N.Bytes()), E: b64(big.NewInt(int64(pub.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk = JWK{Kty: "EC", Crv: pub.Curve.Params().Name, X: b64(pub.X.FillBytes(make([]byte, size))), Y: b64(pub.Y.FillBytes(make([]byte, size)))}
+	default:
+		return JWK{}, fmt.Errorf("jwt: unsupported key type %T", pub)
+	}
+	jwk.Kid = j.KeyID
+	if jwk.Kid == "" {
+		jwk.Kid = jwk.Thumbprint()
+	}
+	jwk.Alg = j.Algorithm
+	jwk.KeyOps = []string{"verify"}
+	return jwk, nil
+}
+
+// Thumbprint returns the RFC 7638 SHA-256 thumbprint of the key.
+func (k JWK) Thumbprint() string {
+	var members string
+	if k.Kty == "EC" {
+		members = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, k.Crv, k.Kty, k.X, k.Y)
+	} else {
+		members = fmt.Sprintf(`{"e":%q,"kty":%q,"n":%q}`, k.E, k.Kty, k.N)
+	}
+	sum := sha256.Sum256([]byte(members))
+	return b64(sum[:])
+}
+
+// jwsHash returns the hash used by the JWS algorithm.
+func jwsHash(alg string) (crypto.Hash, error) {
+	if len(alg) != 5 {
+		return 0, fmt.Errorf("jwt: unsupported algorithm %q", alg)
+	}
+	switch alg[:2] {
+	case "RS", "PS", "ES":
+	default:
+		return 0, fmt.Errorf("jwt: unsupported algorithm %q", alg)
+	}
+	switch alg[2:] {
+	case "256":
+		return crypto.SHA256, nil
+	case "384":
+		return crypto.SHA384, nil
+	case "512":
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("jwt: unsupported algorithm %q", alg)
+}
+
+// ecdsaRawSignature converts an ASN.1 DER ECDSA signature into the fixed
+// size r||s form used by JWS.
+func ecdsaRawSignature(der []byte, size int) ([]byte, error) {
+	var sig struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, fmt.Errorf("jwt: invalid ECDSA signature: %w", err)
+	}
+	raw := make([]byte, 2*size)
+	sig.R.FillBytes(raw[:size])
+	sig.S.FillBytes(raw[size:])
+	return raw, nil
+}
+
+// b64 encodes with unpadded base64url, as used throughout JOSE.
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// randomID returns a random 128 bit hex identifier, such as a JWT "jti".
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,213 @@
+package sling
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	limitRequestBody            = "request body"
+	limitResponseBody           = "response body"
+	limitCompressedResponseBody = "compressed response body"
+	limitResponseHeaderFields   = "response header fields"
+	limitResponseHeaderBytes    = "response headers"
+)
+
+// TooLargeError is returned when a request or response is larger than a
+// limit set with MaxRequestSize, MaxResponseSize or MaxResponseHeaders.
+type TooLargeError struct {
+	// Part is what is over the limit, such as "response body" or
+	// "response header fields".
+	Part string
+	// Limit is the maximum number of bytes, or of fields for header fields.
+	Limit int64
+}
+
+func (e *TooLargeError) Error() string {
+	unit := "bytes"
+	if e.Part == limitResponseHeaderFields {
+		unit = "fields"
+	}
+	return fmt.Sprintf("sling: %s larger than the limit of %d %s", e.Part, e.Limit, unit)
+}
+
+// MaxResponseSize limits the bytes of response bodies to max. Reading a body
+// past the limit fails with a TooLargeError. Unless a request sets its own
+// Accept-Encoding, the Sling asks for and decompresses gzip bodies itself so
+// that the limit applies to both the compressed and decompressed bytes.
+// Receive also limits the decompressed bytes of bodies which the request
+// asked to be compressed. Zero removes the limit.
+func (s *Sling) MaxResponseSize(max int64) *Sling {
+	if max < 0 {
+		max = 0
+	}
+	s.maxResponseSize = max
+	return s
+}
+
+// MaxResponseHeaders limits the number of response header fields and their
+// total bytes, counted as "Name: value\r\n" lines. Responses over either
+// limit fail with a TooLargeError. Zero removes a limit. The headers are
+// checked once they are received, so set the http Transport's
+// MaxResponseHeaderBytes to stop reading them sooner.
+func (s *Sling) MaxResponseHeaders(fields, bytes int) *Sling {
+	if fields < 0 {
+		fields = 0
+	}
+	if bytes < 0 {
+		bytes = 0
+	}
+	s.maxHeaderFields, s.maxHeaderBytes = fields, bytes
+	return s
+}
+
+// MaxRequestSize limits the bytes of request bodies from the BodyProvider to
+// max. Bodies of a known larger length fail when the request is built and
+// others fail with a TooLargeError once they are read past the limit. Zero
+// removes the limit.
+func (s *Sling) MaxRequestSize(max int64) *Sling {
+	if max < 0 {
+		max = 0
+	}
+	s.maxRequestSize = max
+	return s
+}
+
+// limitRequest limits the bytes of the request body.
+func (s *Sling) limitRequest(req *http.Request) error {
+	max := s.maxRequestSize
+	if max == 0 || req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	if req.ContentLength > max {
+		return &TooLargeError{Part: limitRequestBody, Limit: max}
+	}
+	if req.ContentLength > 0 {
+		return nil
+	}
+	body := req.Body
+	req.Body = &readAndClose{&limitedReader{r: body, limit: max, part: limitRequestBody}, body}
+	if getBody := req.GetBody; getBody != nil {
+		req.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			return &readAndClose{&limitedReader{r: body, limit: max, part: limitRequestBody}, body}, nil
+		}
+	}
+	return nil
+}
+
+// acceptGzip asks for a gzip response body which the Sling decompresses
+// itself, as the http Transport would, so its response limit also applies
+// to the compressed bytes. It reports whether it did.
+func (s *Sling) acceptGzip(req *http.Request) bool {
+	if s.maxResponseSize == 0 || req.Method == "HEAD" || req.Header.Get("Accept-Encoding") != "" || req.Header.Get("Range") != "" {
+		return false
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	return true
+}
+
+// limitResponse checks the response headers against the Sling's limits and
+// limits the bytes of its body. If the Sling asked for gzip, the body is
+// decompressed and both streams are limited.
+func (s *Sling) limitResponse(resp *http.Response, gzipped bool) error {
+	if err := s.checkHeaders(resp.Header); err != nil {
+		return err
+	}
+	max := s.maxResponseSize
+	if max == 0 {
+		return nil
+	}
+	if resp.ContentLength > max {
+		part := limitResponseBody
+		if resp.Header.Get("Content-Encoding") != "" {
+			part = limitCompressedResponseBody
+		}
+		return &TooLargeError{Part: part, Limit: max}
+	}
+
+	body := resp.Body
+	var reader io.Reader = body
+	if gzipped && strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		reader = &gzipReader{r: &limitedReader{r: body, limit: max, part: limitCompressedResponseBody}}
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+	}
+	resp.Body = &readAndClose{&limitedReader{r: reader, limit: max, part: limitResponseBody}, body}
+	return nil
+}
+
+// checkHeaders checks the header against the Sling's header limits.
+func (s *Sling) checkHeaders(header http.Header) error {
+	if s.maxHeaderFields == 0 && s.maxHeaderBytes == 0 {
+		return nil
+	}
+	fields, size := 0, 0
+	for key, values := range header {
+		for _, value := range values {
+			fields++
+			size += len(key) + len(value) + len(": \r\n")
+		}
+	}
+	if s.maxHeaderFields > 0 && fields > s.maxHeaderFields {
+		return &TooLargeError{Part: limitResponseHeaderFields, Limit: int64(s.maxHeaderFields)}
+	}
+	if s.maxHeaderBytes > 0 && size > s.maxHeaderBytes {
+		return &TooLargeError{Part: limitResponseHeaderBytes, Limit: int64(s.maxHeaderBytes)}
+	}
+	return nil
+}
+
+// limitedReader reads from r until more than limit bytes are read, then
+// fails with a TooLargeError.
+type limitedReader struct {
+	r     io.Reader
+	limit int64
+	read  int64
+	part  string
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.read > l.limit {
+		return 0, &TooLargeError{Part: l.part, Limit: l.limit}
+	}
+	// read one past the limit to tell a body of exactly the limit apart
+	if room := l.limit - l.read + 1; int64(len(p)) > room {
+		p = p[:room]
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.limit {
+		return n - int(l.read-l.limit), &TooLargeError{Part: l.part, Limit: l.limit}
+	}
+	return n, err
+}
+
+// gzipReader decompresses r, reading the gzip header on the first Read so
+// empty bodies aren't read early.
+type gzipReader struct {
+	r   io.Reader
+	zr  *gzip.Reader
+	err error
+}
+
+func (g *gzipReader) Read(p []byte) (int, error) {
+	if g.err != nil {
+		return 0, g.err
+	}
+	if g.zr == nil {
+		g.zr, g.err = gzip.NewReader(g.r)
+		if g.err != nil {
+			return 0, g.err
+		}
+	}
+	return g.zr.Read(p)
+}
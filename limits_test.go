@@ -0,0 +1,178 @@
+package sling
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaxResponseSize(t *testing.T) {
+	random := make([]byte, 8192)
+	rand.Read(random)
+	var bomb, compressed bytes.Buffer
+	zw := gzip.NewWriter(&bomb)
+	zw.Write([]byte(`{"text": "` + strings.Repeat("a", 1<<20) + `"}`))
+	zw.Close()
+	zw = gzip.NewWriter(&compressed)
+	zw.Write(random)
+	zw.Close()
+
+	var acceptEncoding string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding = r.Header.Get("Accept-Encoding")
+		w.Header().Set(contentType, jsonContentType)
+		switch r.URL.Path {
+		case "/small":
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			fmt.Fprint(zw, `{"text": "Some text"}`)
+			zw.Close()
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(buf.Bytes())
+		case "/length":
+			fmt.Fprint(w, `{"text": "`+strings.Repeat("a", 2048)+`"}`)
+		case "/chunked":
+			for i := 0; i < 4; i++ {
+				fmt.Fprint(w, strings.Repeat(" ", 512))
+				w.(http.Flusher).Flush()
+			}
+		case "/bomb":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(bomb.Bytes())
+		case "/compressed":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.(http.Flusher).Flush()
+			w.Write(compressed.Bytes())
+		}
+	}))
+	defer server.Close()
+
+	s := New().Base(server.URL).MaxResponseSize(1024)
+	model := new(FakeModel)
+	resp, err := s.New().Get("small").ReceiveSuccess(model)
+	if err != nil || model.Text != "Some text" {
+		t.Errorf("expected the gzip body to be decoded, got %v, %v", model, err)
+	}
+	if acceptEncoding != "gzip" || !resp.Uncompressed || resp.Header.Get("Content-Encoding") != "" {
+		t.Errorf("expected the Sling to decompress gzip, got Accept-Encoding %q and %+v", acceptEncoding, resp)
+	}
+
+	cases := []struct {
+		path string
+		part string
+	}{
+		{"length", limitResponseBody},
+		{"chunked", limitResponseBody},
+		{"bomb", limitResponseBody},
+		{"compressed", limitCompressedResponseBody},
+	}
+	for _, c := range cases {
+		resp, err := s.New().Get(c.path).Do(context.Background())
+		if err == nil {
+			_, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		var tooLarge *TooLargeError
+		if !errors.As(err, &tooLarge) || tooLarge.Part != c.part || tooLarge.Limit != 1024 {
+			t.Errorf("%s: expected a %s TooLargeError, got %v", c.path, c.part, err)
+		}
+	}
+
+	// bodies of requests with their own Accept-Encoding are limited as
+	// they are decoded
+	model = new(FakeModel)
+	_, err = s.New().Get("small").Set("Accept-Encoding", "gzip").ReceiveSuccess(model)
+	if err != nil || model.Text != "Some text" {
+		t.Errorf("expected the gzip body to be decoded, got %v, %v", model, err)
+	}
+	_, err = s.New().Get("bomb").Set("Accept-Encoding", "gzip").ReceiveSuccess(new(FakeModel))
+	if tooLarge := new(TooLargeError); !errors.As(err, &tooLarge) || tooLarge.Part != limitResponseBody {
+		t.Errorf("expected a response body TooLargeError, got %v", err)
+	}
+
+	_, err = s.New().Get("bomb").ReceiveSuccess(new(FakeModel))
+	var tooLarge *TooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Errorf("expected a TooLargeError decoding, got %v", err)
+	}
+}
+
+func TestMaxResponseHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Padding", strings.Repeat("a", 100))
+		w.Header().Add("X-Many", "1")
+		w.Header().Add("X-Many", "2")
+		w.WriteHeader(204)
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		fields, bytes int
+		part          string
+	}{
+		{0, 0, ""},
+		{10, 1024, ""},
+		{3, 0, limitResponseHeaderFields},
+		{0, 100, limitResponseHeaderBytes},
+	}
+	for _, c := range cases {
+		_, err := New().Base(server.URL).MaxResponseHeaders(c.fields, c.bytes).ReceiveSuccess(new(FakeModel))
+		var tooLarge *TooLargeError
+		if c.part == "" && err != nil || c.part != "" && (!errors.As(err, &tooLarge) || tooLarge.Part != c.part) {
+			t.Errorf("expected %q TooLargeError, got %v", c.part, err)
+		}
+	}
+}
+
+func TestMaxRequestSize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(204)
+	}))
+	defer server.Close()
+
+	s := New().Base(server.URL).Post("").MaxRequestSize(16)
+	_, err := s.New().BodyJSON(&FakeModel{Text: "some long text over the limit"}).request()
+	var tooLarge *TooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.Part != limitRequestBody {
+		t.Errorf("expected a request body TooLargeError, got %v", err)
+	}
+
+	_, err = s.New().Body(io.MultiReader(strings.NewReader(strings.Repeat("a", 32)))).ReceiveSuccess(new(FakeModel))
+	if !errors.As(err, &tooLarge) || tooLarge.Part != limitRequestBody {
+		t.Errorf("expected a request body TooLargeError, got %v", err)
+	}
+
+	_, err = s.New().Body(io.MultiReader(strings.NewReader(strings.Repeat("a", 16)))).ReceiveSuccess(new(FakeModel))
+	if err != nil {
+		t.Errorf("expected a body of the limit to be sent, got %v", err)
+	}
+}
+
+func TestLimitedReader(t *testing.T) {
+	cases := []struct {
+		body  string
+		limit int64
+		read  string
+		fails bool
+	}{
+		{"", 4, "", false},
+		{"abcd", 4, "abcd", false},
+		{"abcde", 4, "abcd", true},
+		{"abcdefgh", 0, "", true},
+	}
+	for _, c := range cases {
+		read, err := io.ReadAll(&limitedReader{r: strings.NewReader(c.body), limit: c.limit, part: limitResponseBody})
+		if string(read) != c.read || (err != nil) != c.fails {
+			t.Errorf("expected %q (fails %t), got %q, %v", c.read, c.fails, read, err)
+		}
+	}
+}
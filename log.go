@@ -0,0 +1,121 @@
+package sling
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RequestLogger logs every exchange sent through it. Use Wrap as a Sling
+// Middleware or to wrap any Doer:
+//
+//	logger := &sling.RequestLogger{Logf: log.Printf, Bodies: true}
+//	s := sling.New().Redact(policy).Use(logger.Wrap)
+//
+// Headers, query parameters and bodies are masked by the RedactionPolicy of
+// the Sling which sent the request, and Authorization, Proxy-Authorization,
+// Cookie and Set-Cookie headers are always masked.
+type RequestLogger struct {
+	// Logf logs each message, such as log.Printf or testing.T.Logf.
+	Logf func(format string, v ...interface{})
+	// Bodies logs request and response bodies. Response bodies are logged
+	// when they are closed or read to the end.
+	Bodies bool
+	// MaxBodySize caps the bytes of each logged body, and request bodies are
+	// only read this far. Zero logs up to 64KiB.
+	MaxBodySize int
+	// Redaction masks sensitive values. If nil, the RedactionPolicy of the
+	// Sling which sent the request is used.
+	Redaction *RedactionPolicy
+}
+
+// Wrap returns a Doer which logs exchanges sent through next.
+func (l *RequestLogger) Wrap(next Doer) Doer {
+	return DoerFunc(func(req *http.Request) (*http.Response, error) {
+		return l.do(next, req)
+	})
+}
+
+func (l *RequestLogger) do(next Doer, req *http.Request) (*http.Response, error) {
+	policy := requestRedaction(req, l.Redaction)
+	if policy == nil {
+		policy = &RedactionPolicy{}
+	}
+	line := fmt.Sprintf("%s %s", req.Method, policy.maskURL(req.URL))
+	message := "--> " + line + logHeaders(policy.maskHeader(req.Header))
+	if l.Bodies {
+		max := l.maxBodySize()
+		body, _, err := captureRequestBody(req, max)
+		if err != nil {
+			return nil, err
+		}
+		truncated := len(body) > max
+		if truncated {
+			body = body[:max]
+		}
+		message += l.logBody(policy.maskCaptured(body, truncated, req.Header.Get(contentType)), truncated)
+	}
+	l.Logf("%s", message)
+
+	start := time.Now()
+	resp, err := next.Do(req)
+	if err != nil {
+		l.Logf("<-- %s (%s): %v", line, time.Since(start), err)
+		return resp, err
+	}
+
+	message = fmt.Sprintf("<-- %d %s (%s)", resp.StatusCode, line, time.Since(start)) + logHeaders(policy.maskHeader(resp.Header))
+	if !l.Bodies {
+		l.Logf("%s", message)
+		return resp, nil
+	}
+	resp.Body = &captureBody{
+		ReadCloser: resp.Body,
+		max:        l.maxBodySize(),
+		finish: func(content []byte, size int64) {
+			truncated := size > int64(len(content))
+			content = policy.maskCaptured(content, truncated, resp.Header.Get(contentType))
+			l.Logf("%s", message+l.logBody(content, truncated))
+		},
+	}
+	return resp, nil
+}
+
+func (l *RequestLogger) maxBodySize() int {
+	if l.MaxBodySize > 0 {
+		return l.MaxBodySize
+	}
+	return redactionCaptureCap
+}
+
+// logBody formats a body for a log message, cut to the maximum body size.
+func (l *RequestLogger) logBody(body []byte, truncated bool) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if max := l.maxBodySize(); len(body) > max {
+		body, truncated = body[:max], true
+	}
+	if truncated {
+		return "\n\n" + string(body) + " (truncated)"
+	}
+	return "\n\n" + string(body)
+}
+
+// logHeaders formats headers for a log message, one per line in key order.
+func logHeaders(header http.Header) string {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, key := range keys {
+		for _, value := range header[key] {
+			fmt.Fprintf(&b, "\n%s: %s", key, value)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,219 @@
+package sling
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OAuth 1.0a signature methods.
+const (
+	OAuth1HMACSHA1  = "HMAC-SHA1"
+	OAuth1RSASHA1   = "RSA-SHA1"
+	OAuth1Plaintext = "PLAINTEXT"
+)
+
+// OAuth1Placement is where OAuth 1.0a protocol parameters are sent.
+type OAuth1Placement int
+
+const (
+	// OAuth1Header sends the parameters in an "Authorization: OAuth" header.
+	OAuth1Header OAuth1Placement = iota
+	// OAuth1Query sends the parameters in the URL query.
+	OAuth1Query
+)
+
+// OAuth1Signer signs requests with OAuth 1.0a (RFC 5849). The signature
+// covers the method, the normalized URL, the query parameters (including
+// QueryStruct and QueryValues parameters) and the parameters of
+// application/x-www-form-urlencoded bodies, such as BodyForm bodies. Add it
+// to a Sling with Signer. For example,
+//
+//	signer := &sling.OAuth1Signer{
+//	    ConsumerKey:    "key",
+//	    ConsumerSecret: "secret",
+//	    Token:          "token",
+//	    TokenSecret:    "token-secret",
+//	}
+//	s := sling.New().Signer(signer)
+type OAuth1Signer struct {
+	ConsumerKey    string
+	ConsumerSecret string
+	// Token and TokenSecret are the temporary or access token credentials,
+	// empty when requesting temporary credentials.
+	Token       string
+	TokenSecret string
+	// Method is the signature method, by default HMAC-SHA1.
+	Method string
+	// PrivateKey signs RSA-SHA1 signatures, such as an *rsa.PrivateKey.
+	PrivateKey crypto.Signer
+	// Callback and Verifier set the oauth_callback and oauth_verifier
+	// parameters of temporary credential and token requests.
+	Callback string
+	Verifier string
+	// Realm is set as the realm of the Authorization header, if non-empty.
+	Realm     string
+	Placement OAuth1Placement
+}
+
+// oauth1Now and oauth1Nonce return the timestamp and nonce of signed
+// requests.
+var (
+	oauth1Now   = time.Now
+	oauth1Nonce = randomID
+)
+
+// Sign signs the request.
+func (o *OAuth1Signer) Sign(req *http.Request) error {
+	method := o.Method
+	if method == "" {
+		method = OAuth1HMACSHA1
+	}
+	nonce, err := oauth1Nonce()
+	if err != nil {
+		return err
+	}
+
+	oauthParams := map[string]string{
+		"oauth_consumer_key":     o.ConsumerKey,
+		"oauth_nonce":            nonce,
+		"oauth_signature_method": method,
+		"oauth_timestamp":        strconv.FormatInt(oauth1Now().Unix(), 10),
+		"oauth_version":          "1.0",
+	}
+	if o.Token != "" {
+		oauthParams["oauth_token"] = o.Token
+	}
+	if o.Callback != "" {
+		oauthParams["oauth_callback"] = o.Callback
+	}
+	if o.Verifier != "" {
+		oauthParams["oauth_verifier"] = o.Verifier
+	}
+
+	base, err := oauth1SignatureBase(req, oauthParams)
+	if err != nil {
+		return err
+	}
+	key := escapeUnreserved(o.ConsumerSecret) + "&" + escapeUnreserved(o.TokenSecret)
+	switch method {
+	case OAuth1HMACSHA1:
+		mac := hmac.New(sha1.New, []byte(key))
+		mac.Write([]byte(base))
+		oauthParams["oauth_signature"] = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	case OAuth1RSASHA1:
+		if o.PrivateKey == nil {
+			return fmt.Errorf("oauth1: RSA-SHA1 requires a PrivateKey")
+		}
+		digest := sha1.Sum([]byte(base))
+		sig, err := o.PrivateKey.Sign(rand.Reader, digest[:], crypto.SHA1)
+		if err != nil {
+			return err
+		}
+		oauthParams["oauth_signature"] = base64.StdEncoding.EncodeToString(sig)
+	case OAuth1Plaintext:
+		oauthParams["oauth_signature"] = key
+	default:
+		return fmt.Errorf("oauth1: unsupported signature method %q", method)
+	}
+
+	keys := make([]string, 0, len(oauthParams))
+	for k := range oauthParams {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	if o.Placement == OAuth1Query {
+		query := make([]string, len(keys))
+		for i, k := range keys {
+			query[i] = escapeUnreserved(k) + "=" + escapeUnreserved(oauthParams[k])
+		}
+		if req.URL.RawQuery != "" {
+			req.URL.RawQuery += "&"
+		}
+		req.URL.RawQuery += strings.Join(query, "&")
+		return nil
+	}
+
+	params := make([]string, 0, len(keys)+1)
+	if o.Realm != "" {
+		params = append(params, fmt.Sprintf("realm=%q", o.Realm))
+	}
+	for _, k := range keys {
+		params = append(params, fmt.Sprintf("%s=%q", escapeUnreserved(k), escapeUnreserved(oauthParams[k])))
+	}
+	req.Header.Set("Authorization", "OAuth "+strings.Join(params, ", "))
+	return nil
+}
+
+// oauth1SignatureBase returns the signature base string (RFC 5849 section
+// 3.4.1) of the request with the protocol parameters.
+func oauth1SignatureBase(req *http.Request, oauthParams map[string]string) (string, error) {
+	var params [][2]string
+	add := func(values url.Values) {
+		for k, vs := range values {
+			for _, v := range vs {
+				params = append(params, [2]string{escapeUnreserved(k), escapeUnreserved(v)})
+			}
+		}
+	}
+
+	query, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		return "", err
+	}
+	add(query)
+	if strings.HasPrefix(req.Header.Get(contentType), formContentType) {
+		body, err := readRequestBody(req)
+		if err != nil {
+			return "", err
+		}
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return "", err
+		}
+		add(form)
+	}
+	for k, v := range oauthParams {
+		params = append(params, [2]string{escapeUnreserved(k), escapeUnreserved(v)})
+	}
+	sort.Slice(params, func(i, j int) bool {
+		if params[i][0] != params[j][0] {
+			return params[i][0] < params[j][0]
+		}
+		return params[i][1] < params[j][1]
+	})
+	pairs := make([]string, len(params))
+	for i, p := range params {
+		pairs[i] = p[0] + "=" + p[1]
+	}
+
+	return strings.ToUpper(req.Method) + "&" + escapeUnreserved(oauth1BaseURL(req)) + "&" + escapeUnreserved(strings.Join(pairs, "&")), nil
+}
+
+// oauth1BaseURL returns the base string URI: the lowercase scheme and host,
+// without a default port, and the path without the query.
+func oauth1BaseURL(req *http.Request) string {
+	scheme := strings.ToLower(req.URL.Scheme)
+	host := strings.ToLower(requestHost(req))
+	if _, port, err := net.SplitHostPort(host); err == nil {
+		if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+			host = strings.TrimSuffix(host, ":"+port)
+		}
+	}
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	return scheme + "://" + host + path
+}
@@ -0,0 +1,133 @@
+package sling
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// twitterExampleSigner has the credentials of the widely used OAuth 1.0a
+// signing example of the Twitter API documentation.
+func twitterExampleSigner(t *testing.T) *OAuth1Signer {
+	setOAuth1Nonce(t, time.Unix(1318622958, 0), "kYjzVBB8Y0ZFabxSWbWovY3uYSQ2pTgmZeNu2VS4cg")
+	return &OAuth1Signer{
+		ConsumerKey:    "xvz1evFS4wEEPTGEFPHBog",
+		ConsumerSecret: "kAcSOqF21Fu85e7zjz7ZN2U4ZRhfV3WpwPAoE3Z7kBw",
+		Token:          "370773112-GmHxMAgYyLbNEtIKZeRNFsMKPR9EyMZeS9weJAEb",
+		TokenSecret:    "LswwdoUaIvS8ltyTt5jkRh4J50vUPVVHtR2YPi5kE",
+	}
+}
+
+// setOAuth1Nonce signs requests with the timestamp and nonce for the rest of
+// the test.
+func setOAuth1Nonce(t *testing.T, at time.Time, nonce string) {
+	oauth1Now = func() time.Time { return at }
+	oauth1Nonce = func() (string, error) { return nonce, nil }
+	t.Cleanup(func() { oauth1Now, oauth1Nonce = time.Now, randomID })
+}
+
+type statusParams struct {
+	IncludeEntities bool `url:"include_entities"`
+}
+
+func TestOAuth1Signer(t *testing.T) {
+	expected := `OAuth oauth_consumer_key="xvz1evFS4wEEPTGEFPHBog", oauth_nonce="kYjzVBB8Y0ZFabxSWbWovY3uYSQ2pTgmZeNu2VS4cg", oauth_signature="hCtSmYh%2BiHYCEqBWrE7C7hYmtUk%3D", oauth_signature_method="HMAC-SHA1", oauth_timestamp="1318622958", oauth_token="370773112-GmHxMAgYyLbNEtIKZeRNFsMKPR9EyMZeS9weJAEb", oauth_version="1.0"`
+	form := url.Values{"status": {"Hello Ladies + Gentlemen, a signed OAuth request!"}}
+	cases := []*Sling{
+		New().Post("https://api.twitter.com/1.1/statuses/update.json?include_entities=true").BodyForm(form),
+		New().Post("https://API.Twitter.com:443/1.1/statuses/update.json").QueryStruct(statusParams{true}).BodyForm(form),
+		New().Post("https://api.twitter.com/1.1/statuses/update.json").QueryValues(url.Values{"include_entities": {"true"}}).BodyForm(form),
+	}
+	for _, s := range cases {
+		req, err := s.request()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := twitterExampleSigner(t).Sign(req); err != nil {
+			t.Fatal(err)
+		}
+		if got := req.Header.Get("Authorization"); got != expected {
+			t.Errorf("expected Authorization\n%s\ngot\n%s", expected, got)
+		}
+		// the body is still sent
+		body, _ := io.ReadAll(req.Body)
+		if string(body) != form.Encode() {
+			t.Errorf("expected body %s, got %s", form.Encode(), body)
+		}
+	}
+}
+
+func TestOAuth1Signer_query(t *testing.T) {
+	signer := twitterExampleSigner(t)
+	signer.Placement = OAuth1Query
+	req, err := New().Post("https://api.twitter.com/1.1/statuses/update.json?include_entities=true").
+		BodyForm(url.Values{"status": {"Hello Ladies + Gentlemen, a signed OAuth request!"}}).request()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := signer.Sign(req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Header.Get("Authorization") != "" {
+		t.Errorf("expected no Authorization header")
+	}
+	query := req.URL.Query()
+	if got := query.Get("oauth_signature"); got != "hCtSmYh+iHYCEqBWrE7C7hYmtUk=" {
+		t.Errorf("expected oauth_signature hCtSmYh+iHYCEqBWrE7C7hYmtUk=, got %s", got)
+	}
+	if got := query.Get("include_entities"); got != "true" {
+		t.Errorf("expected include_entities to be kept, got %s", got)
+	}
+}
+
+func TestOAuth1Signer_methods(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setOAuth1Nonce(t, time.Unix(137131201, 0), "nonce")
+	signer := &OAuth1Signer{
+		ConsumerKey:    "key",
+		ConsumerSecret: "secret & more",
+		Method:         OAuth1RSASHA1,
+		PrivateKey:     key,
+		Callback:       "https://client.example.com/cb?x=1",
+		Realm:          "Photos",
+	}
+	req, _ := http.NewRequest("GET", "http://Example.com:80/request?b=2&a=1", nil)
+	if err := signer.Sign(req); err != nil {
+		t.Fatal(err)
+	}
+	params := parseChallenges([]string{req.Header.Get("Authorization")})[0].params
+	if params["realm"] != "Photos" || params["oauth_callback"] != "https%3A%2F%2Fclient.example.com%2Fcb%3Fx%3D1" {
+		t.Errorf("expected realm and escaped callback, got %v", params)
+	}
+	base := "GET&http%3A%2F%2Fexample.com%2Frequest&a%3D1%26b%3D2%26oauth_callback%3Dhttps%253A%252F%252Fclient.example.com%252Fcb%253Fx%253D1%26oauth_consumer_key%3Dkey%26oauth_nonce%3Dnonce%26oauth_signature_method%3DRSA-SHA1%26oauth_timestamp%3D137131201%26oauth_version%3D1.0"
+	sig, _ := url.QueryUnescape(params["oauth_signature"])
+	raw, _ := base64.StdEncoding.DecodeString(sig)
+	digest := sha1.Sum([]byte(base))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, digest[:], raw); err != nil {
+		t.Errorf("expected RSA-SHA1 signature of the base string to verify, got %v", err)
+	}
+
+	signer.Method = OAuth1Plaintext
+	if err := signer.Sign(req); err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Header.Get("Authorization"); !strings.Contains(got, `oauth_signature="secret%2520%2526%2520more%26"`) {
+		t.Errorf("expected PLAINTEXT signature of the escaped secrets, got %s", got)
+	}
+
+	signer.Method = "HMAC-SHA256"
+	if err := signer.Sign(req); err == nil {
+		t.Errorf("expected unsupported signature method error")
+	}
+}
@@ -0,0 +1,360 @@
+package sling
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTokenExpirySkew is how long before expiry a cached token is
+// refreshed, allowing for clock skew and request latency.
+const DefaultTokenExpirySkew = 30 * time.Second
+
+// Token is an OAuth2 token returned by a token endpoint.
+type Token struct {
+	AccessToken  string
+	TokenType    string
+	RefreshToken string
+	Scope        string
+	// Expiry is when the access token expires. The zero value never expires.
+	Expiry time.Time
+}
+
+// tokenJSON is the token endpoint response (RFC 6749 section 5.1).
+type tokenJSON struct {
+	AccessToken  string      `json:"access_token"`
+	TokenType    string      `json:"token_type"`
+	RefreshToken string      `json:"refresh_token"`
+	Scope        string      `json:"scope"`
+	ExpiresIn    json.Number `json:"expires_in"`
+}
+
+// TokenError is an OAuth2 error response from a token endpoint (RFC 6749
+// section 5.2).
+type TokenError struct {
+	StatusCode       int    `json:"-"`
+	Code             string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+	ErrorURI         string `json:"error_uri"`
+}
+
+func (e *TokenError) Error() string {
+	msg := fmt.Sprintf("oauth2: token request failed with status code %d: %s", e.StatusCode, e.Code)
+	if e.ErrorDescription != "" {
+		msg += ": " + e.ErrorDescription
+	}
+	return msg
+}
+
+// TokenSource provides OAuth2 tokens to authorize requests.
+type TokenSource interface {
+	// Token returns a token, fetching a new one if needed.
+	Token(ctx context.Context) (*Token, error)
+}
+
+// CachedTokenSource caches the tokens of another TokenSource until shortly
+// before they expire. Concurrent callers share a single token fetch.
+type CachedTokenSource struct {
+	source TokenSource
+	skew   time.Duration
+
+	mu    sync.Mutex
+	token *Token
+}
+
+// NewCachedTokenSource returns a CachedTokenSource which refreshes tokens
+// skew before their expiry.
+func NewCachedTokenSource(source TokenSource, skew time.Duration) *CachedTokenSource {
+	return &CachedTokenSource{source: source, skew: skew}
+}
+
+// Token returns the cached token if it is still valid, or fetches a new one.
+// The lock is held while fetching, so only one fetch is in flight.
+func (c *CachedTokenSource) Token(ctx context.Context) (*Token, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != nil && (c.token.Expiry.IsZero() || time.Now().Add(c.skew).Before(c.token.Expiry)) {
+		return c.token, nil
+	}
+	token, err := c.source.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.token = token
+	return token, nil
+}
+
+// Invalidate discards the cached token if it is still the given token, so
+// the next call to Token fetches a new one.
+func (c *CachedTokenSource) Invalidate(token *Token) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token == token {
+		c.token = nil
+	}
+}
+
+// invalidateHeader discards the cached token if it was used for the
+// Authorization header value. If the token was already replaced, by another
+// request which was rejected, the new token is kept.
+func (c *CachedTokenSource) invalidateHeader(authorization string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != nil && strings.HasSuffix(authorization, " "+c.token.AccessToken) {
+		c.token = nil
+	}
+}
+
+// TokenSource sets the source of OAuth2 tokens used to authorize requests
+// with an "Authorization: <type> <token>" header. Tokens are cached until
+// DefaultTokenExpirySkew before expiry (unless source is already a
+// CachedTokenSource). If a request is rejected with 401 Unauthorized, the
+// token is discarded and the request is retried once with a new token. A nil
+// source removes it.
+func (s *Sling) TokenSource(source TokenSource) *Sling {
+	if source == nil {
+		s.auth = nil
+		return s
+	}
+	cached, ok := source.(*CachedTokenSource)
+	if !ok {
+		cached = NewCachedTokenSource(source, DefaultTokenExpirySkew)
+	}
+	s.auth = &tokenAuth{source: cached}
+	return s
+}
+
+// tokenAuth authorizes requests with tokens from a CachedTokenSource.
+type tokenAuth struct {
+	source *CachedTokenSource
+}
+
+func (a *tokenAuth) authorize(req *http.Request) (*http.Request, error) {
+	token, err := a.source.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	tokenType := token.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	req.Header.Set("Authorization", tokenType+" "+token.AccessToken)
+	return req, nil
+}
+
+func (a *tokenAuth) retry(req *http.Request, resp *http.Response) (bool, error) {
+	if resp.StatusCode != http.StatusUnauthorized {
+		return false, nil
+	}
+	a.source.invalidateHeader(req.Header.Get("Authorization"))
+	return true, nil
+}
+
+// AuthStyle is how OAuth2 client credentials are sent to a token endpoint.
+type AuthStyle int
+
+const (
+	// AuthStyleHeader sends the client ID and secret with HTTP Basic
+	// Authentication.
+	AuthStyleHeader AuthStyle = iota
+	// AuthStyleParams sends the client ID and secret as client_id and
+	// client_secret form parameters.
+	AuthStyleParams
+)
+
+// ClientCredentials fetches tokens with the OAuth2 client credentials grant
+// (RFC 6749 section 4.4).
+type ClientCredentials struct {
+	// Endpoint is a Sling whose Base is the token endpoint URL. It is
+	// extended with New() for each token request.
+	Endpoint     *Sling
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	AuthStyle    AuthStyle
+	// EndpointParams are additional form parameters, such as "audience".
+	EndpointParams url.Values
+}
+
+// Token fetches a new token from the token endpoint.
+func (c *ClientCredentials) Token(ctx context.Context) (*Token, error) {
+	values := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.Scopes) > 0 {
+		values.Set("scope", strings.Join(c.Scopes, " "))
+	}
+	return requestToken(ctx, c.Endpoint, clientAuth{c.ClientID, c.ClientSecret, c.AuthStyle}, values, c.EndpointParams)
+}
+
+// RefreshToken fetches tokens with the OAuth2 refresh token grant (RFC 6749
+// section 6). If the token endpoint rotates the refresh token, the new one
+// is used for later requests.
+type RefreshToken struct {
+	// Endpoint is a Sling whose Base is the token endpoint URL. It is
+	// extended with New() for each token request.
+	Endpoint     *Sling
+	ClientID     string
+	ClientSecret string
+	AuthStyle    AuthStyle
+	// RefreshToken is the initial refresh token.
+	RefreshToken string
+	Scopes       []string
+
+	mu sync.Mutex
+}
+
+// Token fetches a new token from the token endpoint.
+func (r *RefreshToken) Token(ctx context.Context) (*Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.RefreshToken == "" {
+		return nil, fmt.Errorf("oauth2: no refresh token")
+	}
+	values := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {r.RefreshToken}}
+	if len(r.Scopes) > 0 {
+		values.Set("scope", strings.Join(r.Scopes, " "))
+	}
+	token, err := requestToken(ctx, r.Endpoint, clientAuth{r.ClientID, r.ClientSecret, r.AuthStyle}, values, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token.RefreshToken != "" {
+		r.RefreshToken = token.RefreshToken
+	} else {
+		token.RefreshToken = r.RefreshToken
+	}
+	return token, nil
+}
+
+// JWTBearer fetches tokens with the JWT bearer assertion grant (RFC 7523
+// section 2.1), signing a new assertion for each token request.
+type JWTBearer struct {
+	// Endpoint is a Sling whose Base is the token endpoint URL. It is
+	// extended with New() for each token request.
+	Endpoint *Sling
+	Signer   JWTSigner
+	// Issuer, Subject and Audience are the iss, sub and aud claims. The
+	// Audience defaults to the token endpoint URL.
+	Issuer   string
+	Subject  string
+	Audience string
+	Scopes   []string
+	// Lifetime of the assertion, by default 5 minutes.
+	Lifetime time.Duration
+	// Claims are additional assertion claims.
+	Claims map[string]interface{}
+}
+
+// Token fetches a new token from the token endpoint.
+func (j *JWTBearer) Token(ctx context.Context) (*Token, error) {
+	assertion, err := signAssertion(j.Signer, j.Endpoint, j.Issuer, j.Subject, j.Audience, j.Lifetime, j.Claims)
+	if err != nil {
+		return nil, err
+	}
+	values := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	if len(j.Scopes) > 0 {
+		values.Set("scope", strings.Join(j.Scopes, " "))
+	}
+	return requestToken(ctx, j.Endpoint, clientAuth{}, values, nil)
+}
+
+// signAssertion signs a JWT assertion with the standard claims. The audience
+// defaults to the endpoint URL.
+func signAssertion(signer JWTSigner, endpoint *Sling, issuer, subject, audience string, lifetime time.Duration, extra map[string]interface{}) (string, error) {
+	if endpoint == nil {
+		return "", fmt.Errorf("oauth2: no token endpoint")
+	}
+	if audience == "" {
+		audience = endpoint.rawURL
+	}
+	if lifetime <= 0 {
+		lifetime = 5 * time.Minute
+	}
+	jti, err := randomID()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := map[string]interface{}{}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	claims["iss"] = issuer
+	claims["sub"] = subject
+	claims["aud"] = audience
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(lifetime).Unix()
+	claims["jti"] = jti
+	return signer.Sign(claims)
+}
+
+// clientAuth are the client credentials sent to a token endpoint. An empty
+// ClientID sends no credentials.
+type clientAuth struct {
+	id, secret string
+	style      AuthStyle
+}
+
+// requestToken posts the form values to the token endpoint and parses the
+// token response.
+func requestToken(ctx context.Context, endpoint *Sling, auth clientAuth, values, extra url.Values) (*Token, error) {
+	if endpoint == nil {
+		return nil, fmt.Errorf("oauth2: no token endpoint")
+	}
+	for key, vs := range extra {
+		for _, v := range vs {
+			values.Add(key, v)
+		}
+	}
+	s := endpoint.New().Post("").Set("Accept", jsonContentType)
+	// token requests must not be authorized with the tokens they fetch
+	s.auth = nil
+	if auth.id != "" {
+		if auth.style == AuthStyleParams {
+			values.Set("client_id", auth.id)
+			if auth.secret != "" {
+				values.Set("client_secret", auth.secret)
+			}
+		} else {
+			s.SetBasicAuth(url.QueryEscape(auth.id), url.QueryEscape(auth.secret))
+		}
+	}
+
+	tj := new(tokenJSON)
+	tokenErr := new(TokenError)
+	resp, err := s.BodyForm(values).ReceiveWithContext(ctx, tj, tokenErr)
+	if err != nil {
+		return nil, fmt.Errorf("oauth2: token request failed: %w", err)
+	}
+	if !isSuccessful(resp.StatusCode) {
+		tokenErr.StatusCode = resp.StatusCode
+		return nil, tokenErr
+	}
+	if tj.AccessToken == "" {
+		return nil, fmt.Errorf("oauth2: token response has no access_token")
+	}
+
+	token := &Token{
+		AccessToken:  tj.AccessToken,
+		TokenType:    tj.TokenType,
+		RefreshToken: tj.RefreshToken,
+		Scope:        tj.Scope,
+	}
+	if tj.ExpiresIn != "" {
+		seconds, err := tj.ExpiresIn.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("oauth2: invalid expires_in: %w", err)
+		}
+		if seconds > 0 {
+			token.Expiry = time.Now().Add(time.Duration(seconds) * time.Second)
+		}
+	}
+	return token, nil
+}
@@ -0,0 +1,277 @@
+package sling
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tokenServer is a fake OAuth2 token endpoint which issues numbered tokens.
+type tokenServer struct {
+	*httptest.Server
+	requests  int32
+	expiresIn int
+	forms     chan map[string][]string
+}
+
+func newTokenServer(t *testing.T, expiresIn int) *tokenServer {
+	ts := &tokenServer{expiresIn: expiresIn, forms: make(chan map[string][]string, 100)}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assertMethod(t, "POST", r)
+		r.ParseForm()
+		if user, pass, ok := r.BasicAuth(); ok {
+			r.PostForm.Set("basic", user+":"+pass)
+		}
+		ts.forms <- r.PostForm
+		n := atomic.AddInt32(&ts.requests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("client_id") == "bad" {
+			w.WriteHeader(400)
+			fmt.Fprint(w, `{"error": "invalid_client", "error_description": "unknown client"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"access_token": "token-%d", "token_type": "bearer", "expires_in": %d, "refresh_token": "refresh-%d"}`, n, ts.expiresIn, n)
+	}))
+	return ts
+}
+
+// apiServer returns a server which accepts the given bearer token and
+// rejects others with 401.
+func apiServer(validToken *atomic.Value) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+validToken.Load().(string) {
+			w.WriteHeader(401)
+			return
+		}
+		body := make([]byte, 100)
+		n, _ := r.Body.Read(body)
+		fmt.Fprintf(w, `{"text": %q}`, body[:n])
+	}))
+}
+
+func TestClientCredentials(t *testing.T) {
+	ts := newTokenServer(t, 3600)
+	defer ts.Close()
+
+	source := &ClientCredentials{
+		Endpoint:     New().Base(ts.URL + "/token"),
+		ClientID:     "client id",
+		ClientSecret: "secret",
+		Scopes:       []string{"a", "b"},
+	}
+	token, err := source.Token(context.Background())
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if token.AccessToken != "token-1" || time.Until(token.Expiry) < 59*time.Minute {
+		t.Errorf("unexpected token %+v", token)
+	}
+	form := <-ts.forms
+	if form["grant_type"][0] != "client_credentials" || form["scope"][0] != "a b" || form["basic"][0] != "client+id:secret" {
+		t.Errorf("unexpected token request %v", form)
+	}
+
+	source.AuthStyle = AuthStyleParams
+	source.ClientID = "bad"
+	_, err = source.Token(context.Background())
+	var tokenErr *TokenError
+	if !errors.As(err, &tokenErr) || tokenErr.Code != "invalid_client" || tokenErr.StatusCode != 400 {
+		t.Errorf("expected TokenError, got %v", err)
+	}
+}
+
+func TestTokenSource_cachesAndRetries(t *testing.T) {
+	ts := newTokenServer(t, 3600)
+	defer ts.Close()
+	validToken := &atomic.Value{}
+	validToken.Store("token-1")
+	api := apiServer(validToken)
+	defer api.Close()
+
+	source := &ClientCredentials{Endpoint: New().Base(ts.URL), ClientID: "id", ClientSecret: "secret"}
+	base := New().Base(api.URL + "/").TokenSource(source)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := base.New().Post("foo").BodyJSON("x").ReceiveSuccess(&FakeModel{}); err != nil {
+				t.Errorf("expected nil, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&ts.requests); n != 1 {
+		t.Errorf("expected 1 token request, got %d", n)
+	}
+
+	// the API revokes the token, so the request is retried with a new one
+	validToken.Store("token-2")
+	model := new(FakeModel)
+	resp, err := base.New().Post("foo").BodyJSON("replayed").ReceiveSuccess(model)
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("expected retried request to succeed, got %v %v", resp, err)
+	}
+	if model.Text != "\"replayed\"\n" {
+		t.Errorf("expected body to be replayed, got %q", model.Text)
+	}
+
+	// a token which is still rejected is only retried once
+	validToken.Store("never")
+	resp, err = base.New().Get("foo").ReceiveSuccess(&FakeModel{})
+	if err == nil || resp.StatusCode != 401 {
+		t.Errorf("expected 401, got %v %v", resp, err)
+	}
+	if n := atomic.LoadInt32(&ts.requests); n != 3 {
+		t.Errorf("expected 3 token requests, got %d", n)
+	}
+}
+
+func TestCachedTokenSource_expirySkew(t *testing.T) {
+	ts := newTokenServer(t, 20)
+	defer ts.Close()
+
+	source := NewCachedTokenSource(&ClientCredentials{Endpoint: New().Base(ts.URL)}, 30*time.Second)
+	for i := 1; i <= 2; i++ {
+		token, err := source.Token(context.Background())
+		if err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+		// tokens expiring within the skew are always refreshed
+		if expected := fmt.Sprintf("token-%d", i); token.AccessToken != expected {
+			t.Errorf("expected %s, got %s", expected, token.AccessToken)
+		}
+	}
+}
+
+func TestRefreshToken_rotation(t *testing.T) {
+	ts := newTokenServer(t, 3600)
+	defer ts.Close()
+
+	source := &RefreshToken{Endpoint: New().Base(ts.URL), ClientID: "id", RefreshToken: "initial"}
+	for _, expected := range []string{"initial", "refresh-1"} {
+		if _, err := source.Token(context.Background()); err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+		form := <-ts.forms
+		if form["grant_type"][0] != "refresh_token" || form["refresh_token"][0] != expected {
+			t.Errorf("expected refresh token %s, got %v", expected, form)
+		}
+	}
+}
+
+func TestJWTBearer(t *testing.T) {
+	ts := newTokenServer(t, 3600)
+	defer ts.Close()
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	source := &JWTBearer{
+		Endpoint: New().Base(ts.URL + "/token"),
+		Signer:   JWTSigner{Algorithm: "RS256", Key: key, KeyID: "key-1"},
+		Issuer:   "client",
+		Subject:  "user",
+		Scopes:   []string{"read"},
+	}
+	if _, err := source.Token(context.Background()); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	form := <-ts.forms
+	if form["grant_type"][0] != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+		t.Errorf("unexpected grant type %v", form["grant_type"])
+	}
+	header, claims := verifyJWT(t, form["assertion"][0], &key.PublicKey)
+	if header["kid"] != "key-1" || header["alg"] != "RS256" {
+		t.Errorf("unexpected header %v", header)
+	}
+	if claims["iss"] != "client" || claims["sub"] != "user" || claims["aud"] != ts.URL+"/token" || claims["jti"] == "" {
+		t.Errorf("unexpected claims %v", claims)
+	}
+}
+
+func TestJWTSigner(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	cases := []struct {
+		alg string
+		key crypto.Signer
+		pub crypto.PublicKey
+	}{
+		{"RS384", rsaKey, &rsaKey.PublicKey},
+		{"PS256", rsaKey, &rsaKey.PublicKey},
+		{"ES384", ecKey, &ecKey.PublicKey},
+	}
+	for _, c := range cases {
+		jwt, err := JWTSigner{Algorithm: c.alg, Key: c.key}.Sign(map[string]string{"sub": "x"})
+		if err != nil {
+			t.Errorf("%s: expected nil, got %v", c.alg, err)
+			continue
+		}
+		verifyJWT(t, jwt, c.pub)
+	}
+
+	if _, err := (JWTSigner{Algorithm: "ES384", Key: rsaKey}).Sign(nil); err == nil {
+		t.Errorf("expected error signing ES384 with an RSA key")
+	}
+	if _, err := (JWTSigner{Algorithm: "HS256", Key: rsaKey}).Sign(nil); err == nil {
+		t.Errorf("expected error for unsupported algorithm")
+	}
+}
+
+// verifyJWT verifies the JWT signature and returns its header and claims.
+func verifyJWT(t *testing.T, jwt string, pub crypto.PublicKey) (map[string]interface{}, map[string]interface{}) {
+	t.Helper()
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		t.Fatalf("expected 3 JWT parts, got %d", len(parts))
+	}
+	var header, claims map[string]interface{}
+	headerJSON, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	claimsJSON, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	json.Unmarshal(headerJSON, &header)
+	json.Unmarshal(claimsJSON, &claims)
+
+	alg, _ := header["alg"].(string)
+	hash, err := jwsHash(alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	digest := h.Sum(nil)
+
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if strings.HasPrefix(alg, "PS") {
+			err = rsa.VerifyPSS(pub, hash, digest, sig, nil)
+		} else {
+			err = rsa.VerifyPKCS1v15(pub, hash, digest, sig)
+		}
+	case *ecdsa.PublicKey:
+		size := len(sig) / 2
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			err = errors.New("invalid ECDSA signature")
+		}
+	}
+	if err != nil {
+		t.Errorf("%s: %v", alg, err)
+	}
+	return header, claims
+}
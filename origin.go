@@ -0,0 +1,154 @@
+package sling
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// defaultSensitiveHeaders are the request headers carrying credentials.
+var defaultSensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// defaultLeakPolicy is shared by Slings which haven't set trusted hosts or
+// sensitive headers, so their Clients are cached together.
+var defaultLeakPolicy = &leakPolicy{}
+
+// leakPolicy are the hosts trusted with credentials and the headers which
+// carry them. A policy is never modified once set on a Sling.
+type leakPolicy struct {
+	trustedHosts     []string
+	sensitiveHeaders []string
+}
+
+// OriginError is returned when a request with credentials would be sent
+// outside of the Sling's base origin.
+type OriginError struct {
+	// Origin is the scheme and host of the Base URL.
+	Origin string
+	// URL is the request URL.
+	URL string
+}
+
+func (e *OriginError) Error() string {
+	return fmt.Sprintf("sling: request to %s with credentials leaves the base origin %s", e.URL, e.Origin)
+}
+
+// TrustedHosts sets hosts, besides the host of the Base URL, which may
+// receive the Sling's credentials. Hosts are matched against request and
+// redirect hostnames, ignoring case, and "*.example.com" matches any
+// subdomain of example.com.
+func (s *Sling) TrustedHosts(hosts ...string) *Sling {
+	policy := s.leakPolicy()
+	s.leak = &leakPolicy{trustedHosts: append([]string{}, hosts...), sensitiveHeaders: policy.sensitiveHeaders}
+	return s
+}
+
+// SensitiveHeaders adds request headers, such as "X-Api-Key", which carry
+// credentials. Authorization, Proxy-Authorization and Cookie headers are
+// always sensitive.
+func (s *Sling) SensitiveHeaders(names ...string) *Sling {
+	policy := s.leakPolicy()
+	headers := append([]string{}, policy.sensitiveHeaders...)
+	for _, name := range names {
+		headers = append(headers, http.CanonicalHeaderKey(name))
+	}
+	s.leak = &leakPolicy{trustedHosts: policy.trustedHosts, sensitiveHeaders: headers}
+	return s
+}
+
+// AllowCrossOrigin sets whether requests with credentials may be sent
+// outside of the base origin.
+//
+// By default, when a Sling has credentials (sensitive headers, a
+// TokenSource, Session or other authentication, or Signers), building a
+// request whose URL has another scheme or host than the Base URL, and isn't
+// to a TrustedHosts host, fails with an *OriginError. When such requests are
+// sent with an *http.Client, sensitive headers are also removed from
+// redirects to other origins which aren't trusted hosts.
+func (s *Sling) AllowCrossOrigin(allow bool) *Sling {
+	s.allowCrossOrigin = allow
+	return s
+}
+
+// leakPolicy returns the Sling's policy, or the default policy.
+func (s *Sling) leakPolicy() *leakPolicy {
+	if s.leak == nil {
+		return defaultLeakPolicy
+	}
+	return s.leak
+}
+
+// hasCredentials reports whether requests sent by the Sling carry
+// credentials.
+func (s *Sling) hasCredentials() bool {
+	if s.auth != nil || len(s.signers) > 0 {
+		return true
+	}
+	for _, name := range s.leakPolicy().headers() {
+		if s.header.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOrigin returns an *OriginError if a request to reqURL with the
+// Sling's credentials would leave the base origin.
+func (s *Sling) checkOrigin(reqURL *url.URL) error {
+	if s.allowCrossOrigin || s.baseOrigin == "" || !s.hasCredentials() {
+		return nil
+	}
+	if origin(reqURL) == s.baseOrigin || s.leakPolicy().trusted(reqURL.Hostname()) {
+		return nil
+	}
+	return &OriginError{Origin: s.baseOrigin, URL: reqURL.Redacted()}
+}
+
+// headers returns the names of the sensitive headers.
+func (p *leakPolicy) headers() []string {
+	return append(append([]string{}, defaultSensitiveHeaders...), p.sensitiveHeaders...)
+}
+
+// trusted reports whether the hostname is a trusted host.
+func (p *leakPolicy) trusted(hostname string) bool {
+	hostname = strings.ToLower(hostname)
+	for _, host := range p.trustedHosts {
+		host = strings.ToLower(host)
+		if host == hostname || (strings.HasPrefix(host, "*.") && strings.HasSuffix(hostname, host[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRedirect returns a Client CheckRedirect function which removes
+// sensitive headers from redirects to untrusted origins, then applies the
+// base CheckRedirect function or the default limit of 10 redirects.
+func (p *leakPolicy) checkRedirect(base func(*http.Request, []*http.Request) error) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if origin(req.URL) != origin(via[0].URL) && !p.trusted(req.URL.Hostname()) {
+			for _, name := range p.headers() {
+				req.Header.Del(name)
+			}
+		}
+		if base != nil {
+			return base(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+}
+
+// origin returns the lowercase scheme and host of the URL, with the port
+// only if it isn't the default port of the scheme.
+func origin(u *url.URL) string {
+	scheme, host := strings.ToLower(u.Scheme), strings.ToLower(u.Host)
+	if port := u.Port(); (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		host = strings.TrimSuffix(host, ":"+port)
+	}
+	return scheme + "://" + host
+}
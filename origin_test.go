@@ -0,0 +1,93 @@
+package sling
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	base := New().Base("https://api.example.com/v1/")
+	cases := []struct {
+		sling   *Sling
+		allowed bool
+	}{
+		{base.New().Get("users"), true},
+		{base.New().Get("https://other.com/users"), true},
+		{base.New().SetBasicAuth("u", "p").Get("users"), true},
+		{base.New().SetBasicAuth("u", "p").Get("https://api.example.com:443/users"), true},
+		{base.New().SetBasicAuth("u", "p").Get("https://API.example.com/users"), true},
+		{base.New().SetBasicAuth("u", "p").Get("https://other.com/users"), false},
+		{base.New().SetBasicAuth("u", "p").Get("http://api.example.com/users"), false},
+		{base.New().SetBasicAuth("u", "p").Get("https://api.example.com:8443/users"), false},
+		{base.New().SetBasicAuth("u", "p").Get("//other.com/users"), false},
+		{base.New().Set("Cookie", "session=1").Get("https://other.com/users"), false},
+		{base.New().Set("X-Api-Key", "k").Get("https://other.com/users"), true},
+		{base.New().SensitiveHeaders("x-api-key").Set("X-Api-Key", "k").Get("https://other.com/users"), false},
+		{base.New().Signer(SignerFunc(func(*http.Request) error { return nil })).Get("https://other.com/users"), false},
+		{base.New().SetDigestAuth("u", "p").Get("https://other.com/users"), false},
+		{base.New().SetBasicAuth("u", "p").AllowCrossOrigin(true).Get("https://other.com/users"), true},
+		{base.New().SetBasicAuth("u", "p").TrustedHosts("other.com").Get("https://other.com/users"), true},
+		{base.New().SetBasicAuth("u", "p").TrustedHosts("*.example.com").Get("https://files.example.com/a"), true},
+		{base.New().SetBasicAuth("u", "p").TrustedHosts("*.example.com").Get("https://example.com.evil.io/a"), false},
+		// a new Base sets a new origin
+		{base.New().SetBasicAuth("u", "p").Base("https://other.com/").Get("users"), true},
+	}
+	for i, c := range cases {
+		_, err := c.sling.request()
+		var originErr *OriginError
+		if c.allowed && err != nil {
+			t.Errorf("%d: expected request to be allowed, got %v", i, err)
+		}
+		if !c.allowed && (!errors.As(err, &originErr) || originErr.Origin != "https://api.example.com") {
+			t.Errorf("%d: expected an *OriginError, got %v", i, err)
+		}
+	}
+}
+
+func TestLeakPolicy_redirects(t *testing.T) {
+	var received http.Header
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	defer target.Close()
+	// a different port is a different origin, on the same host
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/same" {
+			if r.URL.Query().Get("redirected") == "" {
+				http.Redirect(w, r, "/same?redirected=1", http.StatusFound)
+			}
+			received = r.Header.Clone()
+			return
+		}
+		http.Redirect(w, r, target.URL+"/landing", http.StatusFound)
+	}))
+	defer origin.Close()
+
+	base := New().Base(origin.URL+"/").SetBasicAuth("u", "p").Set("X-Api-Key", "key").SensitiveHeaders("X-Api-Key")
+	cases := []struct {
+		sling    *Sling
+		path     string
+		stripped bool
+	}{
+		{base.New(), "away", true},
+		{base.New().TrustedHosts("127.0.0.1"), "away", false},
+		{base.New(), "same", false},
+	}
+	for _, c := range cases {
+		received = nil
+		resp, err := c.sling.New().Get(c.path).Receive(nil, new(APIError))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK || received == nil {
+			t.Fatalf("expected the redirect to be followed, got %d", resp.StatusCode)
+		}
+		for _, name := range []string{"Authorization", "X-Api-Key"} {
+			if got := received.Get(name) == ""; got != c.stripped {
+				t.Errorf("%s: expected %s stripped %v, got %q", c.path, name, c.stripped, received.Get(name))
+			}
+		}
+	}
+}
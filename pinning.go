@@ -0,0 +1,179 @@
+package sling
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// PinError is returned when no certificate presented by a pinned host
+// matches its pins.
+type PinError struct {
+	// Host is the pinned host, empty for an IP address host whose leaf
+	// certificate wasn't verified.
+	Host string
+	// Pins are the expected SPKI hashes of the host.
+	Pins []string
+	// Chain are the SPKI hashes of the presented certificate chain, leaf
+	// first, to compare with the pins.
+	Chain []string
+}
+
+func (e *PinError) Error() string {
+	host := e.Host
+	if host == "" {
+		host = "the IP address host"
+	}
+	return fmt.Sprintf("sling: no certificate of %s matches its pins, got chain %s", host, strings.Join(e.Chain, ", "))
+}
+
+// SPKIHash returns the base64 SHA-256 hash of the certificate's Subject
+// Public Key Info, as used for pins. For a PEM certificate, it is the output
+// of:
+//
+//	openssl x509 -pubkey -noout | openssl pkey -pubin -outform der | openssl dgst -sha256 -binary | base64
+func SPKIHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// PinSPKI pins the public keys trusted for the host, as SPKIHash values.
+// Connections to the host fail with a *PinError unless a certificate of the
+// verified chain (the leaf, an intermediate or the root) matches one of the
+// pins. Add backup pins, such as the hash of a standby key, so certificates
+// can be rotated without an outage. A host of "*.example.com" pins every
+// subdomain of example.com at any depth, unless a more specific host is
+// pinned.
+//
+// Pins are checked after the usual certificate verification, when the TLS
+// connection is established. If verification is skipped, only the leaf
+// certificate can match, and connections to IP address hosts, which can't
+// be told apart without a verified leaf, must match a pinned address.
+// Repeated calls add hosts.
+func (s *Sling) PinSPKI(host string, pins ...string) *Sling {
+	old := s.transport.pins
+	set := &pinSet{hosts: map[string][]string{}}
+	if old != nil {
+		set.report = old.report
+		for h, p := range old.hosts {
+			set.hosts[h] = p
+		}
+	}
+	set.hosts[strings.ToLower(host)] = append([]string{}, pins...)
+	s.transport.pins = set
+	return s
+}
+
+// PinReportOnly sets a function which is called with pin failures instead of
+// failing the connection, to test pins before enforcing them. A nil report
+// enforces pins.
+func (s *Sling) PinReportOnly(report func(*PinError)) *Sling {
+	set := &pinSet{hosts: map[string][]string{}, report: report}
+	if s.transport.pins != nil {
+		set.hosts = s.transport.pins.hosts
+	}
+	s.transport.pins = set
+	return s
+}
+
+// pinSet are the pins of each host. A pinSet is never modified once set on a
+// Sling.
+type pinSet struct {
+	hosts  map[string][]string
+	report func(*PinError)
+}
+
+// pins returns the pins of the host, or nil if it isn't pinned.
+func (p *pinSet) pins(host string) []string {
+	host = strings.ToLower(host)
+	if pins, ok := p.hosts[host]; ok {
+		return pins
+	}
+	// the nearest wildcard wins, at any depth
+	for domain := host; ; {
+		dot := strings.IndexByte(domain, '.')
+		if dot < 0 {
+			return nil
+		}
+		domain = domain[dot+1:]
+		if pins, ok := p.hosts["*."+domain]; ok {
+			return pins
+		}
+	}
+}
+
+// addressPins returns the pins of all pinned IP address hosts.
+func (p *pinSet) addressPins() []string {
+	var pins []string
+	for host, hostPins := range p.hosts {
+		if net.ParseIP(host) != nil {
+			pins = append(pins, hostPins...)
+		}
+	}
+	return pins
+}
+
+// verifyConnection returns a tls.Config VerifyConnection function which
+// checks the pins, after the next function, if any.
+func (p *pinSet) verifyConnection(next func(tls.ConnectionState) error) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if next != nil {
+			if err := next(cs); err != nil {
+				return err
+			}
+		}
+		host := cs.ServerName
+		var pins []string
+		switch {
+		case host != "":
+			pins = p.pins(host)
+		case len(cs.VerifiedChains) > 0:
+			// IP address hosts send no server name, but the verified leaf
+			// certificate names the address
+			for _, ip := range cs.VerifiedChains[0][0].IPAddresses {
+				if pins = p.pins(ip.String()); pins != nil {
+					host = ip.String()
+					break
+				}
+			}
+		default:
+			// without a server name or verified leaf, the IP address host
+			// is unknown, so it must match one of the pinned addresses
+			pins = p.addressPins()
+		}
+		if len(pins) == 0 {
+			return nil
+		}
+
+		// without verification, the presented chain may include any
+		// certificate, so only the leaf is known to be the server's
+		chains := cs.VerifiedChains
+		if len(chains) == 0 && len(cs.PeerCertificates) > 0 {
+			chains = [][]*x509.Certificate{cs.PeerCertificates[:1]}
+		}
+		for _, chain := range chains {
+			for _, cert := range chain {
+				hash := SPKIHash(cert)
+				for _, pin := range pins {
+					if pin == hash {
+						return nil
+					}
+				}
+			}
+		}
+
+		err := &PinError{Host: host, Pins: pins}
+		for _, cert := range cs.PeerCertificates {
+			err.Chain = append(err.Chain, SPKIHash(cert))
+		}
+		if p.report != nil {
+			p.report(err)
+			return nil
+		}
+		return err
+	}
+}
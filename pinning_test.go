@@ -0,0 +1,144 @@
+package sling
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPinSPKI(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	pin := SPKIHash(server.Certificate())
+	const otherPin = "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+
+	cases := []struct {
+		name   string
+		sling  *Sling
+		pinned bool
+	}{
+		{"matching pin", New().PinSPKI("127.0.0.1", pin), false},
+		{"backup pin", New().PinSPKI("127.0.0.1", otherPin, pin), false},
+		{"wrong pin", New().PinSPKI("127.0.0.1", otherPin), true},
+		{"other host", New().PinSPKI("example.com", otherPin), false},
+		{"later hosts", New().PinSPKI("127.0.0.1", otherPin).PinSPKI("example.com", pin), true},
+	}
+	for _, c := range cases {
+		resp, err := c.sling.RootCAs(pool).Get(server.URL).Receive(nil, new(APIError))
+		var pinErr *PinError
+		if !c.pinned && err != nil {
+			t.Errorf("%s: expected the connection to succeed, got %v", c.name, err)
+		}
+		if c.pinned {
+			if !errors.As(err, &pinErr) {
+				t.Errorf("%s: expected a *PinError, got %v", c.name, err)
+				continue
+			}
+			if pinErr.Host != "127.0.0.1" || len(pinErr.Chain) != 1 || pinErr.Chain[0] != pin {
+				t.Errorf("%s: expected the host and presented chain, got %+v", c.name, pinErr)
+			}
+		}
+		if !c.pinned && (resp == nil || resp.TLS == nil || SPKIHash(resp.TLS.PeerCertificates[0]) != pin) {
+			t.Errorf("%s: expected the TLS connection state", c.name)
+		}
+	}
+}
+
+func TestPinReportOnly(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+
+	var reported []*PinError
+	s := New().RootCAs(pool).PinSPKI("*.example.com", "x").PinSPKI("example.com", SPKIHash(server.Certificate())).PinReportOnly(func(err *PinError) {
+		reported = append(reported, err)
+	}).PinSPKI("127.0.0.1", "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=")
+	// connect to the server as example.com, a name in its certificate
+	s.Dialer(dialerFunc(func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return new(net.Dialer).DialContext(ctx, network, server.Listener.Addr().String())
+	}))
+	if _, err := s.Get("https://example.com/").Receive(nil, new(APIError)); err != nil {
+		t.Fatalf("expected a matching pin to connect, got %v", err)
+	}
+	if _, err := s.Get(server.URL).Receive(nil, new(APIError)); err != nil {
+		t.Fatalf("expected report-only pins not to fail the connection, got %v", err)
+	}
+	if len(reported) != 1 || reported[0].Host != "127.0.0.1" {
+		t.Errorf("expected one reported pin failure, got %v", reported)
+	}
+
+	set := s.transport.pins
+	if len(set.pins("api.example.com")) != 1 || set.pins("api.example.com")[0] != "x" || set.pins("example.org") != nil {
+		t.Errorf("expected *.example.com to pin subdomains of example.com")
+	}
+}
+
+func TestPinSet_wildcard(t *testing.T) {
+	set := New().PinSPKI("*.example.com", "wild").PinSPKI("*.b.example.com", "nested").PinSPKI("api.example.com", "exact").transport.pins
+	cases := []struct {
+		host     string
+		expected string
+	}{
+		{"api.example.com", "exact"},
+		{"www.example.com", "wild"},
+		{"a.b.example.com", "nested"},
+		{"A.C.Example.com", "wild"},
+		{"x.y.z.example.com", "wild"},
+		{"example.com", ""},
+		{"example.org", ""},
+		{"localhost", ""},
+	}
+	for _, c := range cases {
+		got := ""
+		if pins := set.pins(c.host); len(pins) > 0 {
+			got = pins[0]
+		}
+		if got != c.expected {
+			t.Errorf("%s: expected pins %q, got %q", c.host, c.expected, got)
+		}
+	}
+}
+
+func TestPinSPKI_unverified(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	pin := SPKIHash(server.Certificate())
+	const otherPin = "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+	insecure := &tls.Config{InsecureSkipVerify: true}
+
+	// an IP address host without a verified leaf must match a pinned address
+	if _, err := New().TLSConfig(insecure).PinSPKI("127.0.0.1", pin).Get(server.URL).Receive(nil, new(APIError)); err != nil {
+		t.Errorf("expected the leaf to match its pin, got %v", err)
+	}
+	_, err := New().TLSConfig(insecure).PinSPKI("127.0.0.1", otherPin).Get(server.URL).Receive(nil, new(APIError))
+	var pinErr *PinError
+	if !errors.As(err, &pinErr) || pinErr.Host != "" {
+		t.Errorf("expected an unverified IP address host to fail, got %v", err)
+	}
+
+	// without verification, only the leaf can match
+	leaf, err := x509.ParseCertificate(newTestCertificate(t, "example.com").Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := x509.ParseCertificate(newTestCertificate(t, "attacker").Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := New().PinSPKI("example.com", SPKIHash(other)).transport.pins
+	verify := set.verifyConnection(nil)
+	if err := verify(tls.ConnectionState{ServerName: "example.com", PeerCertificates: []*x509.Certificate{leaf, other}}); !errors.As(err, &pinErr) {
+		t.Errorf("expected an unverified intermediate not to match, got %v", err)
+	}
+	if err := verify(tls.ConnectionState{ServerName: "example.com", VerifiedChains: [][]*x509.Certificate{{leaf, other}}}); err != nil {
+		t.Errorf("expected a verified intermediate to match, got %v", err)
+	}
+}
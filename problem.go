@@ -0,0 +1,120 @@
+package sling
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+)
+
+const problemContentType = "application/problem+json"
+
+// Problem is an RFC 9457 (formerly RFC 7807) problem details document.
+// Receive returns one as the error of non-2XX responses with the
+// application/problem+json Content-Type when no failureV is given:
+//
+//	_, err := s.Receive(&patient, nil)
+//	var problem *sling.Problem
+//	if errors.As(err, &problem) && problem.Type == "https://example.com/probs/merged" {
+//	    ...
+//	}
+//
+// See https://www.rfc-editor.org/rfc/rfc9457.
+type Problem struct {
+	// Type is a URI reference identifying the problem type. An empty Type
+	// means "about:blank".
+	Type string `json:"type,omitempty"`
+	// Title is a short summary of the problem type.
+	Title string `json:"title,omitempty"`
+	// Status is the HTTP status code. If the document has none, it is set
+	// from the response.
+	Status int `json:"status,omitempty"`
+	// Detail explains this occurrence of the problem.
+	Detail string `json:"detail,omitempty"`
+	// Instance is a URI reference identifying this occurrence.
+	Instance string `json:"instance,omitempty"`
+	// Extensions are the problem type's other members.
+	Extensions map[string]interface{} `json:"-"`
+}
+
+func (p *Problem) Error() string {
+	title := p.Title
+	if title == "" {
+		title = p.Type
+	}
+	if title == "" {
+		title = http.StatusText(p.Status)
+	}
+	msg := fmt.Sprintf("problem: status code %d: %s", p.Status, title)
+	if p.Detail != "" {
+		msg += ": " + p.Detail
+	}
+	return msg
+}
+
+// UnmarshalJSON decodes the problem members and keeps other members as
+// Extensions. As RFC 9457 asks, members of the wrong type are ignored.
+func (p *Problem) UnmarshalJSON(data []byte) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+	*p = Problem{}
+	fields := map[string]interface{}{
+		"type":     &p.Type,
+		"title":    &p.Title,
+		"status":   &p.Status,
+		"detail":   &p.Detail,
+		"instance": &p.Instance,
+	}
+	for name, value := range members {
+		if field, ok := fields[name]; ok {
+			// a member of the wrong type is left unset
+			json.Unmarshal(value, field)
+			continue
+		}
+		var extension interface{}
+		json.Unmarshal(value, &extension)
+		if p.Extensions == nil {
+			p.Extensions = make(map[string]interface{})
+		}
+		p.Extensions[name] = extension
+	}
+	return nil
+}
+
+// MarshalJSON encodes the problem members together with the Extensions.
+func (p Problem) MarshalJSON() ([]byte, error) {
+	members := make(map[string]interface{}, len(p.Extensions)+5)
+	for name, value := range p.Extensions {
+		members[name] = value
+	}
+	type problem Problem
+	standard, err := json.Marshal(problem(p))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(standard, &members); err != nil {
+		return nil, err
+	}
+	return json.Marshal(members)
+}
+
+// isProblem reports whether the response is a problem details document.
+func isProblem(resp *http.Response) bool {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get(contentType))
+	return err == nil && mediaType == problemContentType
+}
+
+// decodeProblem decodes a problem details response and returns the Problem
+// as the error, or an error if it can't be decoded.
+func (s *Sling) decodeProblem(resp *http.Response) error {
+	problem := new(Problem)
+	if err := s.decodeWith(resp, jsonDecoder{}, problem); err != nil {
+		return err
+	}
+	if problem.Status == 0 {
+		problem.Status = resp.StatusCode
+	}
+	return problem
+}
@@ -0,0 +1,120 @@
+package sling
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProblem_UnmarshalJSON(t *testing.T) {
+	cases := []struct {
+		json     string
+		expected Problem
+	}{
+		{`{}`, Problem{}},
+		{
+			`{"type": "https://example.com/probs/out-of-credit", "title": "You do not have enough credit.", "status": 403, "detail": "Your current balance is 30, but that costs 50.", "instance": "/account/12345/msgs/abc", "balance": 30, "accounts": ["/account/12345", "/account/67890"]}`,
+			Problem{
+				Type:       "https://example.com/probs/out-of-credit",
+				Title:      "You do not have enough credit.",
+				Status:     403,
+				Detail:     "Your current balance is 30, but that costs 50.",
+				Instance:   "/account/12345/msgs/abc",
+				Extensions: map[string]interface{}{"balance": 30.0, "accounts": []interface{}{"/account/12345", "/account/67890"}},
+			},
+		},
+		// members of the wrong type are ignored
+		{`{"title": 5, "status": "404", "detail": "gone"}`, Problem{Detail: "gone"}},
+	}
+	for _, c := range cases {
+		var problem Problem
+		if err := json.Unmarshal([]byte(c.json), &problem); err != nil {
+			t.Errorf("expected nil, got %v", err)
+		}
+		if !reflect.DeepEqual(problem, c.expected) {
+			t.Errorf("expected %+v, got %+v", c.expected, problem)
+		}
+	}
+
+	var problem Problem
+	if err := json.Unmarshal([]byte(`[]`), &problem); err == nil {
+		t.Errorf("expected an error decoding a non-object")
+	}
+}
+
+func TestProblem_MarshalJSON(t *testing.T) {
+	problem := Problem{Title: "Conflict", Status: 409, Extensions: map[string]interface{}{"version": 3}}
+	data, err := json.Marshal(problem)
+	if expected := `{"status":409,"title":"Conflict","version":3}`; err != nil || string(data) != expected {
+		t.Errorf("expected %s, got %s, %v", expected, data, err)
+	}
+}
+
+func TestProblem_Error(t *testing.T) {
+	cases := []struct {
+		problem  Problem
+		expected string
+	}{
+		{Problem{Status: 404}, "problem: status code 404: Not Found"},
+		{Problem{Status: 409, Type: "https://example.com/probs/conflict"}, "problem: status code 409: https://example.com/probs/conflict"},
+		{Problem{Status: 422, Title: "Invalid patient", Detail: "birthDate is in the future"}, "problem: status code 422: Invalid patient: birthDate is in the future"},
+	}
+	for _, c := range cases {
+		if msg := c.problem.Error(); msg != c.expected {
+			t.Errorf("expected %s, got %s", c.expected, msg)
+		}
+	}
+}
+
+func TestReceive_problem(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/problem":
+			w.Header().Set(contentType, "application/problem+json; charset=utf-8")
+			w.WriteHeader(404)
+			fmt.Fprint(w, `{"title": "Patient not found", "instance": "/patients/1", "mrn": "123"}`)
+		case "/invalid":
+			w.Header().Set(contentType, problemContentType)
+			w.WriteHeader(500)
+			fmt.Fprint(w, `not json`)
+		case "/json":
+			w.Header().Set(contentType, jsonContentType)
+			w.WriteHeader(400)
+			fmt.Fprint(w, `{"message": "bad"}`)
+		}
+	}))
+	defer server.Close()
+
+	s := New().Base(server.URL + "/")
+	_, err := s.New().Get("problem").ReceiveSuccess(new(FakeModel))
+	var problem *Problem
+	if !errors.As(err, &problem) {
+		t.Fatalf("expected a *Problem, got %v", err)
+	}
+	expected := &Problem{Title: "Patient not found", Status: 404, Instance: "/patients/1", Extensions: map[string]interface{}{"mrn": "123"}}
+	if !reflect.DeepEqual(problem, expected) {
+		t.Errorf("expected %+v, got %+v", expected, problem)
+	}
+
+	// a failureV takes precedence
+	apiError := new(APIError)
+	_, err = s.New().Get("problem").Receive(nil, apiError)
+	if errors.As(err, &problem) {
+		t.Errorf("expected the problem to be decoded into failureV, got %v", err)
+	}
+
+	_, err = s.New().Get("invalid").ReceiveSuccess(new(FakeModel))
+	if err == nil || errors.As(err, &problem) || !strings.Contains(err.Error(), `got body "not json"`) {
+		t.Errorf("expected a decoding error, got %v", err)
+	}
+
+	_, err = s.New().Get("json").ReceiveSuccess(new(FakeModel))
+	if err == nil || errors.As(err, &problem) {
+		t.Errorf("expected a non-problem error, got %v", err)
+	}
+}
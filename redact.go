@@ -0,0 +1,403 @@
+package sling
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// redactionCaptureCap caps the bytes of a response body captured to build a
+// masked or reformatted error body snippet. Larger bodies are redacted
+// entirely.
+const redactionCaptureCap = 64 << 10
+
+// redactedHeaders are always masked by a RedactionPolicy.
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// RedactionPolicy masks sensitive values, such as protected health
+// information, wherever the Sling renders requests and responses: error
+// body snippets, Curl commands, RequestLogger logs and HARRecorder
+// recordings. Masked values are replaced with "REDACTED".
+//
+// JSON bodies are masked by path. Form bodies are masked by field name, for
+// single segment paths. Other bodies are redacted entirely when the policy
+// masks any body values, since their sensitive parts aren't known.
+type RedactionPolicy struct {
+	// Headers are header names to mask, in addition to Authorization,
+	// Proxy-Authorization, Cookie and Set-Cookie.
+	Headers []string
+	// QueryParams are URL query parameter names to mask.
+	QueryParams []string
+	// JSONPaths are paths of JSON values to mask, with dot separated object
+	// keys such as "patient.name". Arrays are traversed, so "entry.name"
+	// masks the name of each object in the entry array, and "*" matches any
+	// key or array element. Keys match case-insensitively, as encoding/json
+	// decodes them.
+	JSONPaths []string
+	// Types are values of struct types whose fields tagged
+	// `sling:"sensitive"` are masked, at the paths of their JSON names. The
+	// types of BodyJSON payloads and Receive values are also used where they
+	// are known.
+	Types []interface{}
+	// OmitBodySnippets leaves response body snippets out of error messages
+	// entirely.
+	OmitBodySnippets bool
+}
+
+// Redact sets the Sling's redaction policy. A nil policy masks nothing.
+func (s *Sling) Redact(policy *RedactionPolicy) *Sling {
+	s.redaction = policy
+	return s
+}
+
+// redactionKey is the request context key of the Sling's redaction policy,
+// which middleware such as HARRecorder and RequestLogger apply.
+type redactionKey struct{}
+
+// withValues returns a copy of the policy which also masks the sensitive
+// fields of the given values' types.
+func (p *RedactionPolicy) withValues(values ...interface{}) *RedactionPolicy {
+	if p == nil {
+		return nil
+	}
+	policy := *p
+	policy.Types = append(append([]interface{}{}, p.Types...), values...)
+	return &policy
+}
+
+// withRedaction returns the request with the policy in its context.
+func withRedaction(req *http.Request, policy *RedactionPolicy) *http.Request {
+	if policy == nil {
+		return req
+	}
+	return req.WithContext(context.WithValue(req.Context(), redactionKey{}, policy))
+}
+
+// requestRedaction returns the policy of the request's context, or the
+// given policy if it is non-nil.
+func requestRedaction(req *http.Request, policy *RedactionPolicy) *RedactionPolicy {
+	if policy != nil {
+		return policy
+	}
+	policy, _ = req.Context().Value(redactionKey{}).(*RedactionPolicy)
+	return policy
+}
+
+// maskRequest returns a copy of the request with masked header, URL and
+// body. The request body is read and replaced so it can still be sent.
+func (p *RedactionPolicy) maskRequest(req *http.Request) (*http.Request, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	masked := req.Clone(req.Context())
+	masked.Header = p.maskHeader(req.Header)
+	masked.URL = p.maskURL(req.URL)
+	if len(body) == 0 {
+		return masked, nil
+	}
+	body = p.maskBody(body, req.Header.Get(contentType))
+	masked.Body = io.NopCloser(bytes.NewReader(body))
+	masked.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	masked.ContentLength = int64(len(body))
+	return masked, nil
+}
+
+// masksHeader reports whether the header's values are masked.
+func (p *RedactionPolicy) masksHeader(name string) bool {
+	if p == nil {
+		return false
+	}
+	for _, header := range redactedHeaders {
+		if strings.EqualFold(header, name) {
+			return true
+		}
+	}
+	for _, header := range p.Headers {
+		if strings.EqualFold(header, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// maskHeader returns a copy of the header with masked values.
+func (p *RedactionPolicy) maskHeader(header http.Header) http.Header {
+	masked := header.Clone()
+	if p == nil {
+		return masked
+	}
+	for name, values := range masked {
+		if p.masksHeader(name) {
+			masked[name] = make([]string, len(values))
+			for i := range values {
+				masked[name][i] = redacted
+			}
+		}
+	}
+	return masked
+}
+
+// maskURL returns a copy of the URL with masked query parameters and
+// password.
+func (p *RedactionPolicy) maskURL(u *url.URL) *url.URL {
+	masked := *u
+	if p == nil {
+		return &masked
+	}
+	if _, ok := masked.User.Password(); ok {
+		masked.User = url.UserPassword(masked.User.Username(), redacted)
+	}
+	if len(p.QueryParams) == 0 || masked.RawQuery == "" {
+		return &masked
+	}
+	query := masked.Query()
+	for _, name := range p.QueryParams {
+		for i := range query[name] {
+			query[name][i] = redacted
+		}
+	}
+	masked.RawQuery = query.Encode()
+	return &masked
+}
+
+// paths returns the JSON paths to mask, including those of sensitive fields
+// of the policy Types and the given values.
+func (p *RedactionPolicy) paths(values ...interface{}) [][]string {
+	if p == nil {
+		return nil
+	}
+	var paths [][]string
+	for _, path := range p.JSONPaths {
+		paths = append(paths, strings.Split(path, "."))
+	}
+	for _, v := range append(append([]interface{}{}, p.Types...), values...) {
+		if v != nil {
+			paths = append(paths, sensitivePaths(reflect.TypeOf(v))...)
+		}
+	}
+	return paths
+}
+
+// masksBodies reports whether the policy masks any body values.
+func (p *RedactionPolicy) masksBodies(values ...interface{}) bool {
+	return len(p.paths(values...)) > 0
+}
+
+// maskBody returns the body with sensitive values masked, given its
+// Content-Type and the Go values it was encoded from or is decoded into.
+func (p *RedactionPolicy) maskBody(body []byte, contentType string, values ...interface{}) []byte {
+	paths := p.paths(values...)
+	if len(paths) == 0 || len(bytes.TrimSpace(body)) == 0 {
+		return body
+	}
+
+	if strings.HasPrefix(contentType, formContentType) {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return []byte(redacted)
+		}
+		for _, path := range paths {
+			if len(path) != 1 {
+				continue
+			}
+			for key, vs := range form {
+				if path[0] == "*" || strings.EqualFold(path[0], key) {
+					for i := range vs {
+						vs[i] = redacted
+					}
+				}
+			}
+		}
+		return []byte(form.Encode())
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil || decoder.More() {
+		return []byte(redacted)
+	}
+	for _, path := range paths {
+		v = maskJSON(v, path)
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return []byte(redacted)
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+// maskJSON masks the values of decoded JSON at the path.
+func maskJSON(v interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return redacted
+	}
+	switch node := v.(type) {
+	case map[string]interface{}:
+		for key, value := range node {
+			if path[0] == "*" || strings.EqualFold(path[0], key) {
+				node[key] = maskJSON(value, path[1:])
+			}
+		}
+	case []interface{}:
+		for i, value := range node {
+			if path[0] == "*" {
+				node[i] = maskJSON(value, path[1:])
+			} else {
+				node[i] = maskJSON(value, path)
+			}
+		}
+	}
+	return v
+}
+
+// maskCaptured returns a captured body with sensitive values masked. The
+// body was truncated if it had more bytes than were captured.
+func (p *RedactionPolicy) maskCaptured(body []byte, truncated bool, contentType string, values ...interface{}) []byte {
+	if !p.masksBodies(values...) {
+		return body
+	}
+	if truncated {
+		// values of a partial body can't be found reliably
+		return []byte(redacted)
+	}
+	return p.maskBody(body, contentType, values...)
+}
+
+// captureBody captures up to max bytes of a body as it is read and calls
+// finish with them, and the full size, once the body ends or is closed.
+type captureBody struct {
+	io.ReadCloser
+	max     int
+	content bytes.Buffer
+	size    int64
+	finish  func(content []byte, size int64)
+	once    sync.Once
+}
+
+func (b *captureBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += int64(n)
+	if room := b.max - b.content.Len(); room > 0 {
+		if room > n {
+			room = n
+		}
+		b.content.Write(p[:room])
+	}
+	if err == io.EOF {
+		b.done()
+	}
+	return n, err
+}
+
+func (b *captureBody) Close() error {
+	b.done()
+	return b.ReadCloser.Close()
+}
+
+func (b *captureBody) done() {
+	b.once.Do(func() { b.finish(b.content.Bytes(), b.size) })
+}
+
+// captureRequestBody reads up to max+1 bytes of the request body, from a
+// copy if it can be replayed. Otherwise the bytes read are put back in front
+// of the rest of the body, so it is still sent as it streams. It also returns
+// the size of the body, or -1 if it is larger and its length is unknown.
+func captureRequestBody(req *http.Request, max int) ([]byte, int64, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, 0, nil
+	}
+	limit := int64(max)
+	if limit < int64(^uint64(0)>>1) {
+		limit++
+	}
+
+	var body []byte
+	var err error
+	if req.GetBody != nil {
+		var copied io.ReadCloser
+		if copied, err = req.GetBody(); err != nil {
+			return nil, 0, err
+		}
+		body, err = io.ReadAll(io.LimitReader(copied, limit))
+		copied.Close()
+	} else {
+		rest := req.Body
+		body, err = io.ReadAll(io.LimitReader(rest, limit))
+		req.Body = &readAndClose{io.MultiReader(bytes.NewReader(body), rest), rest}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(body) <= max {
+		return body, int64(len(body)), nil
+	}
+	if req.ContentLength > 0 {
+		return body, req.ContentLength, nil
+	}
+	return body, -1, nil
+}
+
+// sensitivePathsCache caches the sensitive JSON paths of types.
+var sensitivePathsCache sync.Map
+
+// sensitivePaths returns the JSON paths of fields tagged
+// `sling:"sensitive"` in the type.
+func sensitivePaths(t reflect.Type) [][]string {
+	if cached, ok := sensitivePathsCache.Load(t); ok {
+		return cached.([][]string)
+	}
+	paths := appendSensitivePaths(nil, t, nil, map[reflect.Type]bool{})
+	sensitivePathsCache.Store(t, paths)
+	return paths
+}
+
+func appendSensitivePaths(paths [][]string, t reflect.Type, prefix []string, visiting map[reflect.Type]bool) [][]string {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Map {
+		return appendSensitivePaths(paths, t.Elem(), append(prefix[:len(prefix):len(prefix)], "*"), visiting)
+	}
+	if t.Kind() != reflect.Struct || visiting[t] {
+		return paths
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		path := prefix
+		if !(field.Anonymous && name == "") {
+			if name == "" {
+				name = field.Name
+			}
+			path = append(prefix[:len(prefix):len(prefix)], name)
+		}
+		if field.Tag.Get("sling") == "sensitive" {
+			paths = append(paths, path)
+			continue
+		}
+		paths = appendSensitivePaths(paths, field.Type, path, visiting)
+	}
+	return paths
+}
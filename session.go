@@ -0,0 +1,211 @@
+package sling
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// CookieJar sets the cookie jar which stores cookies set by responses and
+// adds them to requests, including redirects. The jar is shared with
+// children created with New(). A nil jar keeps the http Client's jar.
+//
+// Use net/http/cookiejar to create a jar:
+//
+//	jar, err := cookiejar.New(nil)
+//	s := sling.New().Base("https://app.example.com/").CookieJar(jar)
+func (s *Sling) CookieJar(jar http.CookieJar) *Sling {
+	if jar == nil {
+		s.transport.jar = nil
+		return s
+	}
+	s.transport.jar = &cookieJar{jar}
+	return s
+}
+
+// Session keeps a cookie based login session, logging in again when the
+// session expires. Requests sent by a Sling with the Session are sent after
+// logging in with the Login Sling. When a response shows the session has
+// expired, the Session logs in again and the request is sent once more, if
+// its body can be replayed. For example,
+//
+//	jar, _ := cookiejar.New(nil)
+//	app := sling.New().Base("https://app.example.com/").CookieJar(jar)
+//	session := &sling.Session{
+//	    Login:           app.New().Post("login").BodyForm(credentials),
+//	    ExpiredRedirect: "/login",
+//	    CSRFCookie:      "XSRF-TOKEN",
+//	    CSRFHeader:      "X-XSRF-TOKEN",
+//	}
+//	api := app.New().Session(session)
+//
+// The Login Sling must share the cookie jar of the Sling sending requests,
+// usually by being created from the same parent.
+type Session struct {
+	// Login sends the login request. Any response other than a 2XX (after
+	// redirects) fails the login.
+	Login *Sling
+	// ExpiredStatus are the status codes of responses which show the session
+	// has expired, by default 401 Unauthorized.
+	ExpiredStatus []int
+	// ExpiredRedirect, if non-empty, is the path prefix of a login page.
+	// Responses redirected to it, or redirecting to it when redirects aren't
+	// followed, show the session has expired.
+	ExpiredRedirect string
+	// CSRFResponseHeader is the name of a response header carrying a CSRF
+	// token. The token from the latest response is kept.
+	CSRFResponseHeader string
+	// CSRFCookie is the name of a cookie carrying a CSRF token.
+	CSRFCookie string
+	// CSRFHeader is the request header the CSRF token is sent in, by default
+	// "X-CSRF-Token".
+	CSRFHeader string
+
+	mu       sync.Mutex
+	loggedIn bool
+	// logins counts logins, so a request rejected in an earlier login
+	// doesn't expire a later one
+	logins int
+	csrf   string
+}
+
+// sessionLoginKey is the request context key of the Session login a
+// request was sent in.
+type sessionLoginKey struct{}
+
+// Session sets the Sling to send requests in the login session. Sessions
+// share their state, so a Session may be used by many Slings. A nil session
+// removes it.
+func (s *Sling) Session(session *Session) *Sling {
+	if session == nil {
+		s.auth = nil
+		return s
+	}
+	s.auth = session
+	return s
+}
+
+// LoggedIn reports whether the Session has logged in and not expired since.
+func (s *Session) LoggedIn() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loggedIn
+}
+
+// Logout forgets the login, so the next request logs in again. Cookies are
+// kept in the cookie jar.
+func (s *Session) Logout() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loggedIn = false
+	s.csrf = ""
+}
+
+func (s *Session) authorize(req *http.Request) (*http.Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.loggedIn {
+		if err := s.login(req); err != nil {
+			return nil, err
+		}
+	}
+	if token := s.csrfToken(req); token != "" {
+		header := s.CSRFHeader
+		if header == "" {
+			header = "X-CSRF-Token"
+		}
+		req.Header.Set(header, token)
+	}
+	return req.WithContext(context.WithValue(req.Context(), sessionLoginKey{}, s.logins)), nil
+}
+
+func (s *Session) retry(req *http.Request, resp *http.Response) (bool, error) {
+	expired := s.expired(resp)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if expired {
+		// only the first of the requests rejected in a login logs in again
+		if login, ok := req.Context().Value(sessionLoginKey{}).(int); !ok || login == s.logins {
+			s.loggedIn = false
+			s.csrf = ""
+		}
+		return true, nil
+	}
+	if s.CSRFResponseHeader != "" {
+		if token := resp.Header.Get(s.CSRFResponseHeader); token != "" {
+			s.csrf = token
+		}
+	}
+	return false, nil
+}
+
+// login sends the login request. The lock must be held.
+func (s *Session) login(req *http.Request) error {
+	if s.Login == nil {
+		return fmt.Errorf("session: no Login Sling")
+	}
+	login := s.Login.New()
+	// the login request must not wait on the session it creates
+	login.auth = nil
+	resp, err := login.Do(req.Context())
+	if resp != nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("session: login failed: %w", err)
+	}
+	if s.expired(resp) {
+		return fmt.Errorf("session: login failed, the response shows no session")
+	}
+	s.loggedIn = true
+	s.logins++
+	s.csrf = ""
+	if s.CSRFResponseHeader != "" {
+		s.csrf = resp.Header.Get(s.CSRFResponseHeader)
+	}
+	return nil
+}
+
+// csrfToken returns the latest CSRF token from a response header, or else
+// the CSRF cookie of the request URL. The lock must be held.
+func (s *Session) csrfToken(req *http.Request) string {
+	if s.csrf != "" {
+		return s.csrf
+	}
+	if s.CSRFCookie == "" || s.Login == nil || s.Login.transport.jar == nil {
+		return ""
+	}
+	for _, cookie := range s.Login.transport.jar.Cookies(req.URL) {
+		if cookie.Name == s.CSRFCookie {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// expired reports whether the response shows the session has expired.
+func (s *Session) expired(resp *http.Response) bool {
+	statuses := s.ExpiredStatus
+	if len(statuses) == 0 {
+		statuses = []int{http.StatusUnauthorized}
+	}
+	for _, status := range statuses {
+		if resp.StatusCode == status {
+			return true
+		}
+	}
+	if s.ExpiredRedirect == "" {
+		return false
+	}
+	if resp.Request != nil && resp.Request.Response != nil && strings.HasPrefix(resp.Request.URL.Path, s.ExpiredRedirect) {
+		return true
+	}
+	if location, err := resp.Location(); err == nil && strings.HasPrefix(location.Path, s.ExpiredRedirect) {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package sling
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// sessionServer is an app with a cookie login session and CSRF tokens.
+type sessionServer struct {
+	mu       sync.Mutex
+	password string
+	session  string
+	logins   int
+	// expire sessions with a redirect to the login page instead of 401
+	redirect bool
+}
+
+func (a *sessionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	switch r.URL.Path {
+	case "/login":
+		if r.Method != "POST" {
+			fmt.Fprint(w, "login page")
+			return
+		}
+		r.ParseForm()
+		if r.PostForm.Get("password") != a.password {
+			http.Redirect(w, r, "/login?failed", http.StatusFound)
+			return
+		}
+		a.logins++
+		a.session = fmt.Sprintf("session-%d", a.logins)
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: a.session, Path: "/"})
+		http.SetCookie(w, &http.Cookie{Name: "XSRF-TOKEN", Value: "csrf-" + a.session, Path: "/"})
+		http.Redirect(w, r, "/home", http.StatusFound)
+	case "/home":
+		fmt.Fprint(w, "home")
+	default:
+		cookie, err := r.Cookie("session")
+		if err != nil || cookie.Value != a.session {
+			if a.redirect {
+				http.Redirect(w, r, "/login", http.StatusFound)
+			} else {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+			return
+		}
+		if r.Method != "GET" && r.Header.Get("X-XSRF-TOKEN") != "csrf-"+a.session {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", jsonContentType)
+		fmt.Fprintf(w, `{"text": %q}`, cookie.Value)
+	}
+}
+
+func newSessionSling(t *testing.T, app *sessionServer, password string) (*Sling, *Session) {
+	server := httptest.NewServer(app)
+	t.Cleanup(server.Close)
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := New().Base(server.URL + "/").CookieJar(jar)
+	session := &Session{
+		Login:           base.New().Post("login").BodyForm(url.Values{"password": {password}}),
+		ExpiredRedirect: "/login",
+		CSRFCookie:      "XSRF-TOKEN",
+		CSRFHeader:      "X-XSRF-TOKEN",
+	}
+	return base.New().Session(session), session
+}
+
+func TestSession(t *testing.T) {
+	for _, redirect := range []bool{false, true} {
+		app := &sessionServer{password: "secret", redirect: redirect}
+		api, session := newSessionSling(t, app, "secret")
+
+		model := new(FakeModel)
+		if _, err := api.New().Post("things").BodyJSON(FakeModel{Text: "a"}).ReceiveSuccess(model); err != nil {
+			t.Fatal(err)
+		}
+		if model.Text != "session-1" || !session.LoggedIn() {
+			t.Errorf("expected request in session-1, got %q", model.Text)
+		}
+		if _, err := api.New().Get("things").ReceiveSuccess(model); err != nil {
+			t.Fatal(err)
+		}
+		if app.logins != 1 {
+			t.Errorf("expected the session to be reused, got %d logins", app.logins)
+		}
+
+		// the server expires the session; the client logs in and replays
+		app.session = "expired"
+		if _, err := api.New().Post("things").Body(strings.NewReader(`{}`)).ReceiveSuccess(model); err != nil {
+			t.Fatal(err)
+		}
+		if model.Text != "session-2" || app.logins != 2 {
+			t.Errorf("redirect %v: expected a new login and session-2, got %q after %d logins", redirect, model.Text, app.logins)
+		}
+	}
+}
+
+func TestSession_concurrentExpiry(t *testing.T) {
+	app := &sessionServer{password: "secret"}
+	api, session := newSessionSling(t, app, "secret")
+	if _, err := api.New().Get("things").ReceiveSuccess(new(FakeModel)); err != nil {
+		t.Fatal(err)
+	}
+
+	// requests sent in the same login are rejected, and retried in turn
+	app.session = "expired"
+	var reqs []*http.Request
+	for i := 0; i < 3; i++ {
+		req, err := api.New().Get("things").request()
+		if err == nil {
+			req, err = session.authorize(req)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		reqs = append(reqs, req)
+	}
+	rejected := &http.Response{StatusCode: http.StatusUnauthorized}
+	for _, req := range reqs {
+		if retry, err := session.retry(req, rejected); !retry || err != nil {
+			t.Fatalf("expected a retry, got %v %v", retry, err)
+		}
+		if _, err := session.authorize(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if app.logins != 2 {
+		t.Errorf("expected one more login, got %d logins", app.logins)
+	}
+}
+
+func TestSession_csrfResponseHeader(t *testing.T) {
+	var sent []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.Header.Get("X-CSRF-Token"))
+		w.Header().Set("X-Next-Token", fmt.Sprintf("token-%d", len(sent)))
+	}))
+	defer server.Close()
+
+	base := New().Base(server.URL + "/")
+	api := base.New().Session(&Session{Login: base.New().Post("login"), CSRFResponseHeader: "X-Next-Token"})
+	for i := 0; i < 2; i++ {
+		resp, err := api.New().Post("things").Do(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	// login, then two requests each with the token of the previous response
+	expected := []string{"", "token-1", "token-2"}
+	if fmt.Sprint(sent) != fmt.Sprint(expected) {
+		t.Errorf("expected CSRF tokens %v, got %v", expected, sent)
+	}
+}
+
+func TestSession_loginFailed(t *testing.T) {
+	app := &sessionServer{password: "secret"}
+	api, session := newSessionSling(t, app, "wrong")
+	_, err := api.New().Get("things").ReceiveSuccess(new(FakeModel))
+	if err == nil || !strings.Contains(err.Error(), "session: login failed") {
+		t.Errorf("expected login failure, got %v", err)
+	}
+	if session.LoggedIn() {
+		t.Errorf("expected not to be logged in")
+	}
+}
@@ -1,14 +1,16 @@
 package sling
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/base64"
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
 	goquery "github.com/google/go-querystring/query"
 )
@@ -87,6 +89,17 @@ type Response struct {
 	// The pointer is shared between responses and should not be
 	// modified.
 	TLS *tls.ConnectionState
+
+	// Body is the raw body of the response, up to the maximum set with
+	// RetainBody. BodyTruncated reports whether the body was larger.
+	Body          []byte
+	BodyTruncated bool
+
+	// ErrorBody is the body of a non-2XX response, if it was retained with
+	// ErrorBodyCapture.Retain. ErrorBodyTruncated reports whether the body
+	// was larger.
+	ErrorBody          []byte
+	ErrorBodyTruncated bool
 }
 
 func newResponse(resp *http.Response) *Response {
@@ -117,6 +130,32 @@ type Doer interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
+// DoerFunc is an adapter to allow the use of ordinary functions as Doers.
+type DoerFunc func(req *http.Request) (*http.Response, error)
+
+// Do calls f(req).
+func (f DoerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware wraps a Doer with client-side behavior such as recording or
+// retrying requests.
+type Middleware func(next Doer) Doer
+
+// Signer signs requests once they are built, with their final method, URL,
+// headers and body, just before they are sent.
+type Signer interface {
+	Sign(req *http.Request) error
+}
+
+// SignerFunc is an adapter to allow the use of ordinary functions as Signers.
+type SignerFunc func(req *http.Request) error
+
+// Sign calls f(req).
+func (f SignerFunc) Sign(req *http.Request) error {
+	return f(req)
+}
+
 // Sling is an HTTP Request builder and sender.
 type Sling struct {
 	// http Client for doing requests
@@ -133,6 +172,50 @@ type Sling struct {
 	bodyProvider BodyProvider
 	// response decoder
 	responseDecoder ResponseDecoder
+	// middleware wrapping the http Client, outermost first
+	middleware []Middleware
+	// transport settings applied to a copy of the http Client
+	transport transportConfig
+	// Clients built from transport settings, shared with children
+	transports *transportCache
+	// time limit for each request, zero for none
+	timeout time.Duration
+	// adds credentials to requests. A Sling has one authenticator, so each of
+	// TokenSource, SetDigestAuth and Session replaces any other.
+	auth authenticator
+	// sign requests just before they are sent, in order
+	signers []Signer
+	// Content-Digest algorithms of request bodies
+	contentDigests []string
+	// verify Content-Digest and Repr-Digest of decoded responses
+	verifyDigests bool
+	// scheme and host of the Base URL, empty if unset
+	baseOrigin string
+	// hosts and headers protected from credential leaks, nil for defaults
+	leak *leakPolicy
+	// allow requests to leave the base origin with credentials
+	allowCrossOrigin bool
+	// masks sensitive values in error messages, logs and recordings
+	redaction *RedactionPolicy
+	// capture of failed response bodies
+	errorBodies ErrorBodyCapture
+	// bytes of received response bodies kept on the Response, zero for none
+	retainBody int
+	// limits of request and response sizes, zero for none
+	maxRequestSize  int64
+	maxResponseSize int64
+	maxHeaderFields int
+	maxHeaderBytes  int
+}
+
+// authenticator adds credentials to requests sent by a Sling.
+type authenticator interface {
+	// authorize adds credentials to the request. It returns the request, or
+	// a copy with state for retry in its context.
+	authorize(req *http.Request) (*http.Request, error)
+	// retry reports whether the request should be sent once more, with new
+	// credentials, after the given response.
+	retry(req *http.Request, resp *http.Response) (bool, error)
 }
 
 // New returns a new Sling with an http DefaultClient.
@@ -143,6 +226,7 @@ func New() *Sling {
 		header:          make(http.Header),
 		queryStructs:    make([]interface{}, 0),
 		responseDecoder: jsonDecoder{},
+		transports:      newTransportCache(),
 	}
 }
 
@@ -165,13 +249,31 @@ func (s *Sling) New() *Sling {
 		headerCopy[k] = v
 	}
 	return &Sling{
-		httpClient:      s.httpClient,
-		method:          s.method,
-		rawURL:          s.rawURL,
-		header:          headerCopy,
-		queryStructs:    append([]interface{}{}, s.queryStructs...),
-		bodyProvider:    s.bodyProvider,
-		responseDecoder: s.responseDecoder,
+		httpClient:       s.httpClient,
+		method:           s.method,
+		rawURL:           s.rawURL,
+		header:           headerCopy,
+		queryStructs:     append([]interface{}{}, s.queryStructs...),
+		bodyProvider:     s.bodyProvider,
+		responseDecoder:  s.responseDecoder,
+		middleware:       append([]Middleware{}, s.middleware...),
+		transport:        s.transport,
+		transports:       s.transports,
+		timeout:          s.timeout,
+		auth:             s.auth,
+		signers:          append([]Signer{}, s.signers...),
+		contentDigests:   append([]string{}, s.contentDigests...),
+		verifyDigests:    s.verifyDigests,
+		baseOrigin:       s.baseOrigin,
+		leak:             s.leak,
+		allowCrossOrigin: s.allowCrossOrigin,
+		redaction:        s.redaction,
+		errorBodies:      s.errorBodies,
+		retainBody:       s.retainBody,
+		maxRequestSize:   s.maxRequestSize,
+		maxResponseSize:  s.maxResponseSize,
+		maxHeaderFields:  s.maxHeaderFields,
+		maxHeaderBytes:   s.maxHeaderBytes,
 	}
 }
 
@@ -179,6 +281,12 @@ func (s *Sling) New() *Sling {
 
 // Client sets the http Client used to do requests. If a nil client is given,
 // the http.DefaultClient will be used.
+//
+// Transport settings, such as Dialer, TLSConfig, PinSPKI and
+// BlockInternalAddresses, are applied to a copy of the Client, with a clone
+// of its Transport. The Transport must then be an *http.Transport, or nil for
+// the default transport, and requests with a custom Doer fail. CookieJar
+// also applies to a copy of the Client, with any Transport.
 func (s *Sling) Client(httpClient *http.Client) *Sling {
 	if httpClient == nil {
 		return s.Doer(http.DefaultClient)
@@ -197,6 +305,42 @@ func (s *Sling) Doer(doer Doer) *Sling {
 	return s
 }
 
+// Use appends middleware which wrap the Sling's Doer when sending requests.
+// The first middleware added is the outermost, so it sees each request first
+// and each response last.
+func (s *Sling) Use(middleware ...Middleware) *Sling {
+	for _, m := range middleware {
+		if m != nil {
+			s.middleware = append(s.middleware, m)
+		}
+	}
+	return s
+}
+
+// Signer appends signers which sign each request just before it is sent,
+// after any credentials from TokenSource are added. Signers run in the order
+// they were added and run again if a request is retried.
+func (s *Sling) Signer(signers ...Signer) *Sling {
+	for _, signer := range signers {
+		if signer != nil {
+			s.signers = append(s.signers, signer)
+		}
+	}
+	return s
+}
+
+// doer returns the Sling's Doer wrapped by its middleware.
+func (s *Sling) doer() (Doer, error) {
+	doer, err := s.httpDoer()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(s.middleware) - 1; i >= 0; i-- {
+		doer = s.middleware[i](doer)
+	}
+	return doer, nil
+}
+
 // Method
 
 // Head sets the Sling method to HEAD and sets the given pathURL.
@@ -313,8 +457,27 @@ func basicAuth(username, password string) string {
 
 // Base sets the rawURL. If you intend to extend the url with Path,
 // baseUrl should be specified with a trailing slash.
+//
+// A "unix://<socket path>:<http path>" rawURL, such as
+// "unix:///var/run/agent.sock:/v1/", dials all connections to the unix
+// domain socket (see UnixSocket) and sets the rawURL to the http path. Any
+// other rawURL stops dialing a socket, so call UnixSocket after Base.
+//
+// The scheme and host of rawURL are the Sling's base origin. Requests with
+// credentials may not leave it, see AllowCrossOrigin.
 func (s *Sling) Base(rawURL string) *Sling {
+	if strings.HasPrefix(rawURL, unixScheme) {
+		socket, httpURL := parseUnixURL(rawURL)
+		s.UnixSocket(socket)
+		rawURL = httpURL
+	} else {
+		s.UnixSocket("")
+	}
 	s.rawURL = rawURL
+	s.baseOrigin = ""
+	if baseURL, err := url.Parse(rawURL); err == nil && baseURL.Host != "" {
+		s.baseOrigin = origin(baseURL)
+	}
 	return s
 }
 
@@ -427,10 +590,18 @@ func (s *Sling) requestWithContext(ctx context.Context) (*http.Request, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := s.checkOrigin(reqURL); err != nil {
+		return nil, err
+	}
 
+	provider := s.bodyProvider
+	if compressed, ok := provider.(compressBodyProvider); ok && s.header.Get("Content-Encoding") != "" {
+		// the body is already encoded as the header says
+		provider = compressed.body
+	}
 	var body io.Reader
-	if s.bodyProvider != nil {
-		body, err = s.bodyProvider.Body()
+	if provider != nil {
+		body, err = provider.Body()
 		if err != nil {
 			return nil, err
 		}
@@ -440,6 +611,31 @@ func (s *Sling) requestWithContext(ctx context.Context) (*http.Request, error) {
 		return nil, err
 	}
 	addHeaders(req, s.header)
+	if encoder, ok := body.(contentEncoder); ok {
+		req.Header.Set("Content-Encoding", encoder.ContentEncoding())
+		if compressed, ok := provider.(compressBodyProvider); ok && compressed.replayable() {
+			req.GetBody = func() (io.ReadCloser, error) {
+				body, err := compressed.Body()
+				if err != nil {
+					return nil, err
+				}
+				return io.NopCloser(body), nil
+			}
+		}
+	}
+	if err := s.limitRequest(req); err != nil {
+		return nil, err
+	}
+	if len(s.contentDigests) > 0 {
+		if err := setContentDigest(req, s.contentDigests); err != nil {
+			return nil, err
+		}
+	}
+	if provider, ok := s.bodyProvider.(jsonBodyProvider); ok {
+		req = withRedaction(req, s.redaction.withValues(provider.payload))
+	} else {
+		req = withRedaction(req, s.redaction)
+	}
 	return req, err
 }
 
@@ -493,6 +689,19 @@ func (s *Sling) ResponseDecoder(decoder ResponseDecoder) *Sling {
 	return s
 }
 
+// RetainBody keeps up to maxBytes of the raw body of each response received
+// with Receive on the Response's Body, for example to audit log, hash or
+// decode it again. The body is kept as it was sent, once any gzip or deflate
+// Content-Encoding is decompressed. It is still read only once, as it is
+// decoded. Zero retains nothing.
+func (s *Sling) RetainBody(maxBytes int) *Sling {
+	if maxBytes < 0 {
+		maxBytes = 0
+	}
+	s.retainBody = maxBytes
+	return s
+}
+
 // ReceiveSuccess creates a new HTTP request and returns the response. Success
 // responses (2XX) are JSON decoded into the value pointed to by successV.
 // Any error creating the request, sending it, or decoding a 2XX response
@@ -506,7 +715,8 @@ func (s *Sling) ReceiveSuccess(successV interface{}) (*Response, error) {
 // other responses are JSON decoded into the value pointed to by failureV.
 // If the status code of response is 204(no content) or the Content-Lenght is 0,
 // decoding is skipped. Any error creating the request, sending it, or decoding
-// the response is returned.
+// the response is returned. Without a failureV, the error of a non-2XX
+// application/problem+json response is the decoded *Problem.
 // Receive is shorthand for calling Request and Do.
 func (s *Sling) Receive(successV, failureV interface{}) (*Response, error) {
 	return s.ReceiveWithContext(context.Background(), successV, failureV)
@@ -520,6 +730,9 @@ func (s *Sling) Receive(successV, failureV interface{}) (*Response, error) {
 // the response is returned.
 // Receive is shorthand for calling Request and Do.
 func (s *Sling) ReceiveWithContext(ctx context.Context, successV, failureV interface{}) (*Response, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
 	req, err := s.requestWithContext(ctx)
 	if err != nil {
 		return nil, err
@@ -528,15 +741,21 @@ func (s *Sling) ReceiveWithContext(ctx context.Context, successV, failureV inter
 }
 
 func (s *Sling) Do(ctx context.Context) (*http.Response, error) {
+	ctx, cancel := s.withTimeout(ctx)
+
 	req, err := s.requestWithContext(ctx)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 
 	resp, err := s.do(req)
 	if err != nil {
+		cancel()
 		return resp, err
 	}
+	// the timeout covers reading the body, so cancel once it is closed
+	resp.Body = &cancelOnClose{resp.Body, cancel}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		return resp, fmt.Errorf("status code %d was not successful", resp.StatusCode)
@@ -546,7 +765,13 @@ func (s *Sling) Do(ctx context.Context) (*http.Response, error) {
 }
 
 func (s *Sling) do(req *http.Request) (*http.Response, error) {
-	resp, err := s.httpClient.Do(req)
+	doer, err := s.doer()
+	if err != nil {
+		return nil, err
+	}
+
+	gzipped := s.acceptGzip(req)
+	resp, err := s.send(doer, req)
 	if err != nil {
 		if err == context.Canceled {
 			ctxErr := context.Cause(req.Context())
@@ -554,9 +779,92 @@ func (s *Sling) do(req *http.Request) (*http.Response, error) {
 				err = ctxErr
 			}
 		}
+		return resp, err
 	}
 
-	return resp, err
+	if err := s.limitResponse(resp, gzipped); err != nil {
+		resp.Body.Close()
+		return resp, err
+	}
+	return resp, nil
+}
+
+// send sends the request with the Sling's credentials. If the authenticator
+// asks for a retry and the request body can be replayed, the request is sent
+// once more with new credentials.
+func (s *Sling) send(doer Doer, req *http.Request) (*http.Response, error) {
+	if s.auth == nil {
+		if err := s.sign(req); err != nil {
+			return nil, err
+		}
+		return doer.Do(req)
+	}
+	// the replay starts from the request as built, without the credentials,
+	// signatures and cookies added to it on the way
+	header, reqURL := req.Header.Clone(), *req.URL
+	req, err := s.auth.authorize(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sign(req); err != nil {
+		return nil, err
+	}
+	resp, err := doer.Do(req)
+	if err != nil {
+		return resp, err
+	}
+
+	retry, err := s.auth.retry(req, resp)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if !retry {
+		return resp, nil
+	}
+	replay, ok := replayRequest(req)
+	if !ok {
+		return resp, nil
+	}
+	replay.Header, replay.URL = header, &reqURL
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if replay, err = s.auth.authorize(replay); err != nil {
+		return nil, err
+	}
+	if err := s.sign(replay); err != nil {
+		return nil, err
+	}
+	return doer.Do(replay)
+}
+
+// sign signs the request with each of the Sling's signers.
+func (s *Sling) sign(req *http.Request) error {
+	for _, signer := range s.signers {
+		if err := signer.Sign(req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replayRequest returns a copy of the request with a fresh body, or false if
+// the body can't be replayed.
+func replayRequest(req *http.Request) (*http.Request, bool) {
+	replay := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return replay, true
+	}
+	if req.GetBody == nil {
+		return nil, false
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, false
+	}
+	replay.Body = body
+	return replay, true
 }
 
 // Do sends an HTTP request and returns the response. Success responses (2XX)
@@ -570,9 +878,33 @@ func (s *Sling) doDecode(req *http.Request, successV, failureV interface{}) (*Re
 		return nil, fmt.Errorf("at least one of successV or failureV must be non-nil")
 	}
 
+	resp, _, err := s.doDecodeTarget(req, func(code int) interface{} {
+		if isSuccessful(code) {
+			return successV
+		}
+		return failureV
+	}, successV, failureV)
+	return resp, err
+}
+
+// doDecodeTarget sends an HTTP request and decodes the response into the
+// value the target function picks for its status code. If it picks nil,
+// decoding is skipped and unsuccessful responses are returned as errors.
+// The 204 (no content) and zero Content-Length handling is that of doDecode.
+// The values are those target may pick. It reports whether the picked value
+// was decoded into without error.
+func (s *Sling) doDecodeTarget(req *http.Request, target func(code int) interface{}, values ...interface{}) (*Response, bool, error) {
+	if s.redaction != nil {
+		// mask the fields of the values decoded into as well as the body's
+		policy := requestRedaction(req, nil)
+		if policy == nil {
+			policy = s.redaction
+		}
+		req = withRedaction(req, policy.withValues(values...))
+	}
 	resp, err := s.do(req)
 	if err != nil {
-		return newResponse(resp), err
+		return newResponse(resp), false, err
 	}
 	// when err is nil, resp contains a non-nil resp.Body which must be closed
 	defer resp.Body.Close()
@@ -585,102 +917,161 @@ func (s *Sling) doDecode(req *http.Request, successV, failureV interface{}) (*Re
 
 	// Don't try to decode on 204s
 	if resp.StatusCode == http.StatusNoContent {
-		return newResponse(resp), nil
+		return newResponse(resp), false, nil
 	}
 
+	v := target(resp.StatusCode)
+
 	// Don't decode if the content length is 0
 	if resp.ContentLength == 0 {
-		if failureV == nil && !isSuccessful(resp.StatusCode) {
-			return newResponse(resp), fmt.Errorf("status code %d was not successful and had no body", resp.StatusCode)
+		if v == nil && !isSuccessful(resp.StatusCode) {
+			return newResponse(resp), false, fmt.Errorf("status code %d was not successful and had no body", resp.StatusCode)
+		}
+
+		return newResponse(resp), false, nil
+	}
+
+	var digests *digestReader
+	if s.verifyDigests {
+		digests, err = newDigestReader(resp)
+		if err != nil {
+			return newResponse(resp), false, err
 		}
+	}
 
-		return newResponse(resp), nil
+	s.decompressBody(resp)
+
+	// retained bodies are copied as the decoder reads them
+	retained := s.retainWriter(resp)
+	if retained != nil {
+		resp.Body = &readAndClose{io.TeeReader(resp.Body, retained), resp.Body}
 	}
 
+	// the decoder sees UTF-8 without a byte order mark
+	transcodeBody(resp)
+
 	// Decode the body
-	err = decodeResponse(resp, s.responseDecoder, successV, failureV)
-	return newResponse(resp), err
+	err = s.decodeResponse(resp, v)
+	if err == nil && digests != nil {
+		err = digests.verify()
+	}
+	response := newResponse(resp)
+	if retained != nil {
+		// retain the rest of the body the decoder didn't read
+		io.Copy(io.Discard, resp.Body)
+		s.retain(response, retained)
+	}
+	return response, v != nil && err == nil, err
 }
 
-var bodyContextCap = 100
+// retainWriter returns a writer which keeps as much of the response body as
+// the Sling retains, or nil if it retains none.
+func (s *Sling) retainWriter(resp *http.Response) *maxSizeWriter {
+	max := s.retainBody
+	if s.errorBodies.Retain && !isSuccessful(resp.StatusCode) && s.errorBodyRetainCap() > max {
+		max = s.errorBodyRetainCap()
+	}
+	if max == 0 {
+		return nil
+	}
+	return newMaxSizeWriter(max)
+}
 
-// decodeResponse decodes response Body into the value pointed to by successV
-// if the response is a success (2XX) or into the value pointed to by failureV
-// otherwise. If the successV or failureV argument to decode into is nil,
-// decoding is skipped.
-// Caller is responsible for closing the resp.Body.
-func decodeResponse(resp *http.Response, decoder ResponseDecoder, successV, failureV interface{}) error {
-	if code := resp.StatusCode; isSuccessful(code) {
-		if successV != nil {
-			return decode(resp, decoder, successV)
+// retain sets the retained bodies of the response.
+func (s *Sling) retain(response *Response, retained *maxSizeWriter) {
+	body := retained.bytes()
+	if s.errorBodies.Retain && !isSuccessful(response.StatusCode) {
+		response.ErrorBody, response.ErrorBodyTruncated = body, retained.truncated()
+		if max := s.errorBodyRetainCap(); len(body) > max {
+			response.ErrorBody, response.ErrorBodyTruncated = body[:max], true
 		}
-	} else {
-		if failureV != nil {
-			return decode(resp, decoder, failureV)
+	}
+	if s.retainBody > 0 {
+		response.Body, response.BodyTruncated = body, retained.truncated()
+		if len(body) > s.retainBody {
+			response.Body, response.BodyTruncated = body[:s.retainBody], true
+		}
+	}
+}
+
+// decodeResponse decodes response Body into the value pointed to by v. If v
+// is nil, decoding is skipped and an unsuccessful (non-2XX) response is
+// returned as an error. Body snippets in errors are captured as set by
+// ErrorBodies and masked by the Sling's RedactionPolicy.
+// Caller is responsible for closing the resp.Body.
+func (s *Sling) decodeResponse(resp *http.Response, v interface{}) error {
+	if v != nil {
+		return s.decode(resp, v)
+	}
+	if code := resp.StatusCode; !isSuccessful(code) {
+		if isProblem(resp) {
+			return s.decodeProblem(resp)
 		}
 
-		body, err := readWithCap(resp.Body, bodyContextCap)
+		capture := s.snippetCapture(resp)
+		if capture == 0 {
+			return fmt.Errorf("status code %d was not successful", code)
+		}
+		body, truncated, err := readWithCap(resp.Body, capture)
 		if err != nil {
 			return fmt.Errorf("status code %d was not successful and could not read body: %w", code, err)
 		}
 
-		return fmt.Errorf("status code %d was not successful, got body: %s", code, body)
+		return fmt.Errorf("status code %d was not successful, got body: %s", code, s.snippet(resp, body, truncated))
 	}
 	return nil
 }
 
-func readWithCap(r io.Reader, cap int) (string, error) {
+// readWithCap reads at most cap bytes of r, and reports whether r had more.
+func readWithCap(r io.Reader, cap int) ([]byte, bool, error) {
 	// Read one past the cap to distinguish between a body with a length that's exactly `cap` and a body that's larger
-	buf := make([]byte, cap+1)
-	n, err := io.ReadFull(r, buf)
-	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
-		return "", err
+	body, err := io.ReadAll(io.LimitReader(r, int64(cap)+1))
+	if err != nil {
+		return nil, false, err
 	}
 
-	if n == 0 {
-		return "", fmt.Errorf("got no response content")
+	if len(body) == 0 {
+		return nil, false, fmt.Errorf("got no response content")
 	}
 
-	var body string
-	if n <= cap {
-		body = string(buf[:n])
-	} else {
-		// If the body is larger than the cap, it has to be truncated
-		body = string(buf[:cap]) + " (truncated)"
+	if len(body) <= cap {
+		return body, false, nil
 	}
-
-	return body, nil
+	// If the body is larger than the cap, it has to be truncated
+	return body[:cap], true, nil
 }
 
+// maxSizeWriter keeps the first max bytes written to it. It grows as bytes
+// are written, so a large max costs nothing for small bodies.
 type maxSizeWriter struct {
-	bytes        []byte
+	buf          bytes.Buffer
+	max          int
 	triedWriting int
 }
 
 func newMaxSizeWriter(maxSize int) *maxSizeWriter {
-	return &maxSizeWriter{bytes: make([]byte, 0, maxSize)}
+	return &maxSizeWriter{max: maxSize}
 }
 
 func (w *maxSizeWriter) Write(p []byte) (int, error) {
 	w.triedWriting += len(p)
 
-	unwrittenBytes := cap(w.bytes) - len(w.bytes)
-
-	if len(p) < unwrittenBytes {
-		w.bytes = append(w.bytes, p...)
-	} else {
-		w.bytes = append(w.bytes, p[:unwrittenBytes]...)
+	if room := w.max - w.buf.Len(); room > 0 {
+		if room > len(p) {
+			room = len(p)
+		}
+		w.buf.Write(p[:room])
 	}
 
 	return len(p), nil
 }
 
-func (w *maxSizeWriter) String() string {
-	if w.triedWriting > len(w.bytes) {
-		return string(w.bytes) + " (truncated)"
-	}
+func (w *maxSizeWriter) bytes() []byte {
+	return w.buf.Bytes()
+}
 
-	return string(w.bytes)
+func (w *maxSizeWriter) truncated() bool {
+	return w.triedWriting > w.buf.Len()
 }
 
 type readAndClose struct {
@@ -688,13 +1079,32 @@ type readAndClose struct {
 	io.Closer
 }
 
-func decode(resp *http.Response, decoder ResponseDecoder, v interface{}) error {
-	bodyContext := newMaxSizeWriter(bodyContextCap)
+func (s *Sling) decode(resp *http.Response, v interface{}) error {
+	return s.decodeWith(resp, s.responseDecoder, v)
+}
+
+// decodeWith decodes the response with the decoder, with a body snippet in
+// the error if it fails.
+func (s *Sling) decodeWith(resp *http.Response, decoder ResponseDecoder, v interface{}) error {
+	capture := s.snippetCapture(resp, v)
+	if capture == 0 {
+		if err := decoder.Decode(resp, v); err != nil {
+			return fmt.Errorf("could not decode response with status code %d: %w", resp.StatusCode, err)
+		}
+		return nil
+	}
+
+	bodyContext := newMaxSizeWriter(capture)
 	resp.Body = &readAndClose{io.TeeReader(resp.Body, bodyContext), resp.Body}
 
 	err := decoder.Decode(resp, v)
 	if err != nil {
-		return fmt.Errorf("could not decode response with status code %d: %w, got body %q", resp.StatusCode, err, bodyContext.String())
+		// the decoder may stop early, so read the rest of a snippet which
+		// is masked or reformatted as a whole
+		if capture > s.errorBodies.maxBytes() && !bodyContext.truncated() {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, int64(capture-bodyContext.buf.Len()+1)))
+		}
+		return fmt.Errorf("could not decode response with status code %d: %w, got body %q", resp.StatusCode, err, s.snippet(resp, bodyContext.bytes(), bodyContext.truncated(), v))
 	}
 
 	return nil
@@ -3,6 +3,7 @@ package sling
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
@@ -1021,6 +1022,46 @@ func TestDoDecode(t *testing.T) {
 	}
 }
 
+func TestRetainBody(t *testing.T) {
+	body := `{"text": "Some text", "favorite_count": 24}`
+	cases := []struct {
+		max       int
+		status    int
+		successV  interface{}
+		failureV  interface{}
+		expected  string
+		truncated bool
+	}{
+		{0, 200, new(FakeModel), nil, "", false},
+		{1024, 200, new(FakeModel), nil, body, false},
+		{len(body), 200, new(FakeModel), nil, body, false},
+		{10, 200, new(FakeModel), nil, body[:10], true},
+		{1024, 200, nil, new(APIError), body, false},
+		{1024, 400, nil, new(APIError), body, false},
+		{1024, 400, new(FakeModel), nil, body, false},
+	}
+	for _, c := range cases {
+		resp := &http.Response{StatusCode: c.status, ContentLength: int64(len(body)), Body: io.NopCloser(strings.NewReader(body))}
+		s := New().Doer(&fakeDoer{Response: resp}).RetainBody(c.max)
+		response, _ := s.doDecode(nil, c.successV, c.failureV)
+		if string(response.Body) != c.expected || response.BodyTruncated != c.truncated {
+			t.Errorf("expected body %q (truncated %t), got %q (truncated %t)", c.expected, c.truncated, response.Body, response.BodyTruncated)
+		}
+	}
+
+	// the retained body can be decoded again into another shape
+	resp := &http.Response{StatusCode: 200, ContentLength: int64(len(body)), Body: io.NopCloser(strings.NewReader(body))}
+	model := new(FakeModel)
+	response, err := New().Doer(&fakeDoer{Response: resp}).RetainBody(1024).doDecode(nil, model, nil)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(response.Body, &raw); err != nil || raw["text"] != model.Text {
+		t.Errorf("expected the retained body to decode like %v, got %v (%v)", model, raw, err)
+	}
+}
+
 type fakeDoer struct {
 	Response *http.Response
 	Err      error
@@ -0,0 +1,45 @@
+package slingtest
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DecompressRequests returns a handler which decompresses gzip and deflate
+// request bodies, as sent by sling.CompressBody, before calling next. The
+// Content-Encoding and Content-Length headers are removed. Bodies with other
+// encodings are rejected with 415 Unsupported Media Type and bodies which
+// can't be decompressed with 400 Bad Request.
+func DecompressRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.ReadCloser
+		var err error
+		switch encoding := strings.ToLower(r.Header.Get("Content-Encoding")); encoding {
+		case "", "identity":
+			next.ServeHTTP(w, r)
+			return
+		case "gzip", "x-gzip":
+			body, err = gzip.NewReader(r.Body)
+		case "deflate":
+			body, err = zlib.NewReader(r.Body)
+		default:
+			http.Error(w, "unsupported Content-Encoding "+encoding, http.StatusUnsupportedMediaType)
+			return
+		}
+		if err != nil {
+			http.Error(w, "could not decompress body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer body.Close()
+
+		r = r.Clone(r.Context())
+		r.Body = body
+		r.ContentLength = -1
+		r.Header.Del("Content-Encoding")
+		r.Header.Del("Content-Length")
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,60 @@
+package slingtest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mypricehealth/sling"
+)
+
+func TestDecompressRequests(t *testing.T) {
+	server := httptest.NewServer(DecompressRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Content-Encoding", r.Header.Get("Content-Encoding"))
+		io.Copy(w, r.Body)
+	})))
+	defer server.Close()
+
+	type batch struct {
+		Items []string `json:"items"`
+	}
+	sent := &batch{Items: []string{"a", "b", "c"}}
+	for _, encoding := range []string{"", sling.EncodingGzip, sling.EncodingDeflate} {
+		s := sling.New().Base(server.URL).Post("").BodyJSON(sent)
+		if encoding != "" {
+			s.Compress(sling.Compression{Encoding: encoding})
+		}
+		received := new(batch)
+		resp, err := s.ReceiveSuccess(received)
+		if err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+		if len(received.Items) != 3 || resp.Header.Get("X-Content-Encoding") != "" {
+			t.Errorf("expected the %q body to be decompressed, got %v", encoding, received)
+		}
+	}
+
+	req, _ := http.NewRequest("POST", server.URL, bytes.NewReader([]byte("x")))
+	req.Header.Set("Content-Encoding", "br")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("expected 415, got %d", resp.StatusCode)
+	}
+	req, _ = http.NewRequest("POST", server.URL, bytes.NewReader([]byte("not gzip")))
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,60 @@
+// Package slingtest provides helpers for testing API clients built with sling.
+package slingtest
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mypricehealth/sling"
+)
+
+// UpdateGolden makes AssertGolden and AssertGoldenBytes rewrite golden files
+// instead of comparing them. It defaults to whether the SLING_UPDATE_GOLDEN
+// environment variable is set, and may be set from a test's own flag:
+//
+//	var update = flag.Bool("update", false, "rewrite golden files")
+//
+//	func TestMain(m *testing.M) {
+//	    flag.Parse()
+//	    slingtest.UpdateGolden = *update
+//	    os.Exit(m.Run())
+//	}
+var UpdateGolden = os.Getenv("SLING_UPDATE_GOLDEN") != ""
+
+// AssertGolden builds the request for the Sling, renders it with
+// sling.CanonicalRequest and compares it to testdata/<name>.golden. When
+// UpdateGolden is set, the golden file is rewritten instead.
+func AssertGolden(t testing.TB, s *sling.Sling, name string) {
+	t.Helper()
+	got, err := s.Canonical()
+	if err != nil {
+		t.Fatalf("could not render request: %v", err)
+	}
+	AssertGoldenBytes(t, got, name)
+}
+
+// AssertGoldenBytes compares got to testdata/<name>.golden. When UpdateGolden
+// is set, the golden file is rewritten instead.
+func AssertGoldenBytes(t testing.TB, got []byte, name string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if UpdateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("could not create testdata directory: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("could not update golden file: %v", err)
+		}
+		return
+	}
+
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read golden file (set SLING_UPDATE_GOLDEN=1 to create it): %v", err)
+	}
+	if !bytes.Equal(expected, got) {
+		t.Errorf("request does not match %s\nexpected:\n%s\ngot:\n%s", path, expected, got)
+	}
+}
@@ -0,0 +1,34 @@
+package slingtest
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/mypricehealth/sling"
+)
+
+type params struct {
+	KindName string `url:"kind_name"`
+	Count    int    `url:"count"`
+}
+
+type model struct {
+	Text          string `json:"text"`
+	FavoriteCount int64  `json:"favorite_count"`
+}
+
+func TestAssertGolden(t *testing.T) {
+	base := sling.New().Base("https://example.com/api/").Set("User-Agent", "sling").Set("Accept", "application/json")
+
+	cases := []struct {
+		name  string
+		sling *sling.Sling
+	}{
+		{"get_query", base.New().Get("items").QueryStruct(params{KindName: "recent", Count: 25}).QueryValues(url.Values{"a": {"b c"}})},
+		{"post_json", base.New().Post("items").BodyJSON(model{Text: "note", FavoriteCount: 12})},
+		{"post_form", base.New().Post("items").BodyForm(params{KindName: "vanilla", Count: 11})},
+	}
+	for _, c := range cases {
+		AssertGolden(t, c.sling, c.name)
+	}
+}
@@ -0,0 +1,132 @@
+package sling
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// SMARTConfiguration is the subset of a FHIR server's
+// .well-known/smart-configuration used by backend services.
+type SMARTConfiguration struct {
+	TokenEndpoint                              string   `json:"token_endpoint"`
+	TokenEndpointAuthMethodsSupported          []string `json:"token_endpoint_auth_methods_supported"`
+	TokenEndpointAuthSigningAlgValuesSupported []string `json:"token_endpoint_auth_signing_alg_values_supported"`
+	ScopesSupported                            []string `json:"scopes_supported"`
+	Capabilities                               []string `json:"capabilities"`
+}
+
+// SMARTBackend fetches access tokens with the SMART Backend Services flow:
+// a client credentials grant authenticated with a signed JWT client
+// assertion. Use it as a Sling TokenSource, which caches the scoped tokens:
+//
+//	fhir := sling.New().Base("https://fhir.example.com/r4/")
+//	smart := &sling.SMARTBackend{
+//	    FHIRBase: fhir,
+//	    ClientID: "my-client",
+//	    Signer:   sling.JWTSigner{Algorithm: "RS384", Key: key, KeyID: "key-1"},
+//	    Scopes:   []string{"system/Patient.rs"},
+//	}
+//	patients := fhir.New().TokenSource(smart)
+//
+// See https://hl7.org/fhir/smart-app-launch/backend-services.html.
+type SMARTBackend struct {
+	// FHIRBase is a Sling whose Base is the FHIR server base URL, with a
+	// trailing slash. The token endpoint is discovered from its
+	// .well-known/smart-configuration unless TokenEndpoint is set.
+	FHIRBase *Sling
+	// TokenEndpoint is a Sling whose Base is the token endpoint URL. If nil,
+	// it is discovered on the first token request.
+	TokenEndpoint *Sling
+	ClientID      string
+	// Signer signs the client assertions with RS384 or ES384. The KeyID
+	// must match the kid of the key in the client's registered JWKS. If it
+	// is empty, the RFC 7638 thumbprint of the key is used.
+	Signer JWTSigner
+	Scopes []string
+	// Lifetime of the client assertions, by default and at most 5 minutes.
+	Lifetime time.Duration
+
+	mu sync.Mutex
+}
+
+// Token fetches a new access token from the token endpoint.
+func (b *SMARTBackend) Token(ctx context.Context) (*Token, error) {
+	switch b.Signer.Algorithm {
+	case "RS384", "ES384":
+	default:
+		return nil, fmt.Errorf("smart: client assertions must be signed with RS384 or ES384, got %q", b.Signer.Algorithm)
+	}
+
+	endpoint, err := b.tokenEndpoint(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	signer := b.Signer
+	if signer.KeyID == "" {
+		jwk, err := signer.PublicJWK()
+		if err != nil {
+			return nil, err
+		}
+		signer.KeyID = jwk.Kid
+	}
+	lifetime := b.Lifetime
+	if lifetime <= 0 || lifetime > 5*time.Minute {
+		lifetime = 5 * time.Minute
+	}
+	assertion, err := signAssertion(signer, endpoint, b.ClientID, b.ClientID, "", lifetime, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	values := url.Values{
+		"grant_type":            {"client_credentials"},
+		"client_assertion_type": {clientAssertionType},
+		"client_assertion":      {assertion},
+	}
+	if len(b.Scopes) > 0 {
+		values.Set("scope", strings.Join(b.Scopes, " "))
+	}
+	return requestToken(ctx, endpoint, clientAuth{}, values, nil)
+}
+
+// tokenEndpoint returns the configured token endpoint, or discovers and
+// caches it from the FHIR server's SMART configuration.
+func (b *SMARTBackend) tokenEndpoint(ctx context.Context) (*Sling, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.TokenEndpoint != nil {
+		return b.TokenEndpoint, nil
+	}
+	if b.FHIRBase == nil {
+		return nil, fmt.Errorf("smart: one of FHIRBase or TokenEndpoint must be set")
+	}
+	config, err := DiscoverSMARTConfiguration(ctx, b.FHIRBase)
+	if err != nil {
+		return nil, err
+	}
+	b.TokenEndpoint = b.FHIRBase.New().Base(config.TokenEndpoint)
+	return b.TokenEndpoint, nil
+}
+
+// DiscoverSMARTConfiguration fetches the SMART configuration of the FHIR
+// server whose base URL, with a trailing slash, is the Base of fhirBase.
+func DiscoverSMARTConfiguration(ctx context.Context, fhirBase *Sling) (*SMARTConfiguration, error) {
+	config := new(SMARTConfiguration)
+	s := fhirBase.New().Get(".well-known/smart-configuration").Set("Accept", jsonContentType)
+	s.auth = nil
+	_, err := s.ReceiveWithContext(ctx, config, nil)
+	if err != nil {
+		return nil, fmt.Errorf("smart: could not discover configuration: %w", err)
+	}
+	if config.TokenEndpoint == "" {
+		return nil, fmt.Errorf("smart: configuration has no token_endpoint")
+	}
+	return config, nil
+}
@@ -0,0 +1,96 @@
+package sling
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSMARTBackend(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	signer := JWTSigner{Algorithm: "ES384", Key: key}
+	jwk, err := signer.PublicJWK()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+
+	var discoveries, tokens int32
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	mux.HandleFunc("/r4/.well-known/smart-configuration", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&discoveries, 1)
+		fmt.Fprintf(w, `{"token_endpoint": "%s/auth/token", "token_endpoint_auth_signing_alg_values_supported": ["ES384"]}`, server.URL)
+	})
+	mux.HandleFunc("/auth/token", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&tokens, 1)
+		assertPostForm(t, map[string]string{
+			"grant_type":            "client_credentials",
+			"scope":                 "system/Patient.rs",
+			"client_assertion_type": clientAssertionType,
+			"client_assertion":      r.FormValue("client_assertion"),
+		}, r)
+		header, claims := verifyJWT(t, r.FormValue("client_assertion"), &key.PublicKey)
+		if header["kid"] != jwk.Kid {
+			t.Errorf("expected kid %s, got %v", jwk.Kid, header["kid"])
+		}
+		if claims["iss"] != "client" || claims["sub"] != "client" || claims["aud"] != server.URL+"/auth/token" {
+			t.Errorf("unexpected claims %v", claims)
+		}
+		if exp, iat := claims["exp"].(float64), claims["iat"].(float64); exp-iat > 300 {
+			t.Errorf("expected assertion lifetime of at most 5 minutes, got %vs", exp-iat)
+		}
+		fmt.Fprint(w, `{"access_token": "smart-token", "token_type": "bearer", "expires_in": 300, "scope": "system/Patient.rs"}`)
+	})
+	mux.HandleFunc("/r4/Patient/1", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer smart-token" {
+			w.WriteHeader(401)
+			return
+		}
+		fmt.Fprint(w, `{"text": "patient"}`)
+	})
+
+	fhir := New().Base(server.URL + "/r4/")
+	smart := &SMARTBackend{FHIRBase: fhir, ClientID: "client", Signer: signer, Scopes: []string{"system/Patient.rs"}}
+	// the FHIR base may itself use the SMART token source
+	fhir.TokenSource(smart)
+
+	for i := 0; i < 2; i++ {
+		model := new(FakeModel)
+		if _, err := fhir.New().Get("Patient/1").ReceiveSuccess(model); err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+		if model.Text != "patient" {
+			t.Errorf("expected patient, got %s", model.Text)
+		}
+	}
+	if discoveries != 1 || tokens != 1 {
+		t.Errorf("expected 1 discovery and 1 token request, got %d and %d", discoveries, tokens)
+	}
+}
+
+func TestSMARTBackend_algorithm(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	smart := &SMARTBackend{TokenEndpoint: New().Base("http://a.io/token"), Signer: JWTSigner{Algorithm: "ES256", Key: key}}
+	if _, err := smart.Token(context.Background()); err == nil {
+		t.Errorf("expected error for ES256 client assertions")
+	}
+}
+
+func TestJWKThumbprint(t *testing.T) {
+	// RFC 7638 section 3.1 example
+	jwk := JWK{
+		Kty: "RSA",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:   "AQAB",
+	}
+	if expected := "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; jwk.Thumbprint() != expected {
+		t.Errorf("expected %s, got %s", expected, jwk.Thumbprint())
+	}
+}
@@ -0,0 +1,158 @@
+package sling
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// blockedPrefixes are the address ranges which requests may not reach when
+// internal addresses are blocked.
+var blockedPrefixes = []netip.Prefix{
+	// "this" network and unspecified addresses
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("::/128"),
+	// loopback
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("::1/128"),
+	// private networks
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("fc00::/7"),
+	// shared address space, used by some cloud metadata services
+	netip.MustParsePrefix("100.64.0.0/10"),
+	// link-local, including the 169.254.169.254 metadata service
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("fe80::/10"),
+	// IETF protocol assignments and benchmarking
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	// multicast, reserved and broadcast
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("ff00::/8"),
+	// NAT64 and 6to4 addresses can embed any IPv4 address
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2002::/16"),
+}
+
+// BlockedAddressError is returned when a connection to an internal address
+// is blocked.
+type BlockedAddressError struct {
+	// Host is the dialed host name or address.
+	Host string
+	// Addr is the blocked address Host resolved to.
+	Addr netip.Addr
+}
+
+func (e *BlockedAddressError) Error() string {
+	if e.Host == e.Addr.String() {
+		return fmt.Sprintf("sling: connection to internal address %s is blocked", e.Addr)
+	}
+	return fmt.Sprintf("sling: connection to %s at internal address %s is blocked", e.Host, e.Addr)
+}
+
+// BlockInternalAddresses sets whether connections to loopback, link-local
+// (including cloud metadata services), private and other internal addresses
+// are blocked, to protect against server-side request forgery when request
+// URLs come from users. Connections to the allowed prefixes are permitted
+// anyway, such as netip.MustParsePrefix("10.1.0.0/16").
+//
+// Host names are resolved when each connection is dialed and the checked
+// address is dialed, so redirects and DNS rebinding can't reach internal
+// addresses. Blocked connections fail with a *BlockedAddressError.
+// Connections to unix domain sockets aren't checked.
+//
+// Since only the address of a proxy could be checked, the http Client's
+// proxy, such as one from the environment, isn't used. A proxy set with
+// Proxy is used, and only its address is checked.
+func (s *Sling) BlockInternalAddresses(block bool, allowed ...netip.Prefix) *Sling {
+	if !block {
+		s.transport.addressPolicy = nil
+		return s
+	}
+	s.transport.addressPolicy = &addressPolicy{allowed: append([]netip.Prefix{}, allowed...)}
+	return s
+}
+
+// addressPolicy blocks connections to internal addresses.
+type addressPolicy struct {
+	allowed []netip.Prefix
+}
+
+// lookupAddrs resolves the host names of connections checked by an
+// addressPolicy.
+var lookupAddrs = func(ctx context.Context, host string) ([]netip.Addr, error) {
+	return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+}
+
+// blocked reports whether connections to the address are blocked.
+func (p *addressPolicy) blocked(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range p.allowed {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// dialer returns a ContextDialer which resolves and checks addresses before
+// dialing them with next.
+func (p *addressPolicy) dialer(next ContextDialer) ContextDialer {
+	return dialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+		switch network {
+		case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6":
+		default:
+			return next.DialContext(ctx, network, address)
+		}
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+
+		var addrs []netip.Addr
+		if addr, err := netip.ParseAddr(host); err == nil {
+			addrs = []netip.Addr{addr}
+		} else {
+			addrs, err = lookupAddrs(ctx, host)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var firstErr error
+		for _, addr := range addrs {
+			if p.blocked(addr) {
+				if firstErr == nil {
+					firstErr = &BlockedAddressError{Host: host, Addr: addr.Unmap()}
+				}
+				continue
+			}
+			conn, err := next.DialContext(ctx, network, net.JoinHostPort(addr.Unmap().String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			firstErr = err
+		}
+		if firstErr == nil {
+			firstErr = fmt.Errorf("sling: no addresses for %s", host)
+		}
+		return nil, firstErr
+	})
+}
+
+// dialerFunc is an adapter to use a function as a ContextDialer.
+type dialerFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+func (f dialerFunc) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return f(ctx, network, address)
+}
@@ -0,0 +1,126 @@
+package sling
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAddressPolicy_blocked(t *testing.T) {
+	policy := &addressPolicy{allowed: []netip.Prefix{netip.MustParsePrefix("10.1.0.0/16")}}
+	cases := map[string]bool{
+		"127.0.0.1":        true,
+		"::1":              true,
+		"::ffff:127.0.0.1": true,
+		"10.0.0.1":         true,
+		"10.1.2.3":         false,
+		"172.16.5.4":       true,
+		"172.32.0.1":       false,
+		"192.168.1.1":      true,
+		"169.254.169.254":  true,
+		"fd00:ec2::254":    true,
+		"fe80::1":          true,
+		"100.100.100.200":  true,
+		"0.0.0.0":          true,
+		"224.0.0.1":        true,
+		"64:ff9b::a00:1":   true,
+		"8.8.8.8":          false,
+		"2001:4860::8888":  false,
+	}
+	for addr, blocked := range cases {
+		if got := policy.blocked(netip.MustParseAddr(addr)); got != blocked {
+			t.Errorf("%s: expected blocked %v, got %v", addr, blocked, got)
+		}
+	}
+}
+
+func TestBlockInternalAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			// internal.test resolves to another loopback address
+			http.Redirect(w, r, "http://internal.test:"+r.URL.Port()+"/", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", jsonContentType)
+		w.Write([]byte(`{"text": "reached"}`))
+	}))
+	defer server.Close()
+	port := server.URL[strings.LastIndexByte(server.URL, ':')+1:]
+
+	resolve := func(addrs ...string) func(context.Context, string) ([]netip.Addr, error) {
+		return func(context.Context, string) ([]netip.Addr, error) {
+			var parsed []netip.Addr
+			for _, addr := range addrs {
+				parsed = append(parsed, netip.MustParseAddr(addr))
+			}
+			return parsed, nil
+		}
+	}
+	loopback := netip.MustParsePrefix("127.0.0.1/32")
+
+	cases := []struct {
+		name    string
+		url     string
+		allowed []netip.Prefix
+		lookup  func(context.Context, string) ([]netip.Addr, error)
+		blocked string
+	}{
+		{"loopback", server.URL, nil, nil, "127.0.0.1"},
+		{"allowed prefix", server.URL, []netip.Prefix{loopback}, nil, ""},
+		{"redirect", server.URL + "/redirect", []netip.Prefix{loopback}, resolve("127.0.0.2"), "127.0.0.2"},
+		{"resolved", "http://service.test:" + port, []netip.Prefix{loopback}, resolve("127.0.0.1"), ""},
+		{"rebinding", "http://service.test:" + port, []netip.Prefix{loopback}, resolve("169.254.169.254"), "169.254.169.254"},
+		{"mixed", "http://service.test:" + port, []netip.Prefix{loopback}, resolve("10.0.0.1", "127.0.0.1"), ""},
+		{"metadata", "http://169.254.169.254/latest/meta-data/", nil, nil, "169.254.169.254"},
+	}
+	defaultLookup := lookupAddrs
+	defer func() { lookupAddrs = defaultLookup }()
+	for _, c := range cases {
+		lookupAddrs = defaultLookup
+		if c.lookup != nil {
+			lookupAddrs = c.lookup
+		}
+		s := New().Get(c.url).BlockInternalAddresses(true, c.allowed...)
+		model := new(FakeModel)
+		_, err := s.ReceiveSuccess(model)
+
+		var blockedErr *BlockedAddressError
+		if c.blocked == "" {
+			if err != nil || model.Text != "reached" {
+				t.Errorf("%s: expected the server to be reached, got %v", c.name, err)
+			}
+			continue
+		}
+		if !errors.As(err, &blockedErr) || blockedErr.Addr.String() != c.blocked {
+			t.Errorf("%s: expected %s to be blocked, got %v", c.name, c.blocked, err)
+		}
+	}
+
+	// a proxy from the environment would only have its own address checked
+	t.Setenv("HTTP_PROXY", server.URL)
+	envProxy := &http.Client{Transport: &http.Transport{Proxy: func(*http.Request) (*url.URL, error) {
+		return url.Parse(os.Getenv("HTTP_PROXY"))
+	}}}
+	metadata := "http://169.254.169.254/latest/meta-data/"
+	_, err := New().Client(envProxy).Get(metadata).BlockInternalAddresses(true, loopback).ReceiveSuccess(new(FakeModel))
+	var blockedErr *BlockedAddressError
+	if !errors.As(err, &blockedErr) || blockedErr.Addr.String() != "169.254.169.254" {
+		t.Errorf("expected the environment proxy not to be used, got %v", err)
+	}
+	// a proxy set on the Sling is used
+	model := new(FakeModel)
+	if _, err := New().Get(metadata).Proxy(server.URL).BlockInternalAddresses(true, loopback).ReceiveSuccess(model); err != nil || model.Text != "reached" {
+		t.Errorf("expected the Sling's proxy to be used, got %v", err)
+	}
+
+	// blocking is opt-in
+	if _, err := New().Get(server.URL).BlockInternalAddresses(false).ReceiveSuccess(new(FakeModel)); err != nil {
+		t.Errorf("expected requests to internal addresses by default, got %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package sling
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultTarget is the target ReceiveTargets reports when a response was
+// decoded into its defaultV.
+const DefaultTarget = "default"
+
+// Targets maps status codes to the values responses with those status codes
+// are decoded into. Keys are status codes such as "202", classes such as
+// "4XX", or inclusive ranges such as "500-503". When keys overlap, the
+// narrowest match wins. Targets with nil values are ignored.
+type Targets map[string]interface{}
+
+// statusTarget is a parsed Targets key and its value.
+type statusTarget struct {
+	key      string
+	min, max int
+	v        interface{}
+}
+
+// parseTargets parses the keys of the targets, narrowest first.
+func parseTargets(targets Targets) ([]statusTarget, error) {
+	parsed := make([]statusTarget, 0, len(targets))
+	for key, v := range targets {
+		min, max, err := parseStatusRange(key)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, statusTarget{key: key, min: min, max: max, v: v})
+	}
+	sort.Slice(parsed, func(i, j int) bool {
+		wi, wj := parsed[i].max-parsed[i].min, parsed[j].max-parsed[j].min
+		if wi != wj {
+			return wi < wj
+		}
+		return parsed[i].key < parsed[j].key
+	})
+	return parsed, nil
+}
+
+// parseStatusRange parses a status code, class or range.
+func parseStatusRange(key string) (int, int, error) {
+	invalid := fmt.Errorf("sling: invalid status code target %q", key)
+	trimmed := strings.TrimSpace(key)
+	var min, max int
+	switch {
+	case len(trimmed) == 3 && strings.EqualFold(trimmed[1:], "XX"):
+		class, err := strconv.Atoi(trimmed[:1])
+		if err != nil {
+			return 0, 0, invalid
+		}
+		min, max = class*100, class*100+99
+	case strings.Contains(trimmed, "-"):
+		parts := strings.SplitN(trimmed, "-", 2)
+		var err1, err2 error
+		min, err1 = strconv.Atoi(strings.TrimSpace(parts[0]))
+		max, err2 = strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err1 != nil || err2 != nil {
+			return 0, 0, invalid
+		}
+	default:
+		code, err := strconv.Atoi(trimmed)
+		if err != nil {
+			return 0, 0, invalid
+		}
+		min, max = code, code
+	}
+	if min < 100 || max > 599 || min > max {
+		return 0, 0, invalid
+	}
+	return min, max, nil
+}
+
+// ReceiveTargets creates a new HTTP request and decodes the response into
+// the value of the targets matching its status code, or into defaultV if
+// none match. It reports which target was decoded into: the matching key,
+// DefaultTarget, or "" if decoding was skipped or failed. For example,
+//
+//	var patient Patient
+//	var job Job
+//	var conflict Conflict
+//	resp, target, err := s.ReceiveTargets(sling.Targets{
+//	    "200": &patient,
+//	    "202": &job,
+//	    "409": &conflict,
+//	}, nil)
+//
+// As with Receive, decoding is skipped if the status code of the response
+// is 204 (no content) or the Content-Length is 0, and an unsuccessful
+// (non-2XX) response without a target is returned as an error.
+func (s *Sling) ReceiveTargets(targets Targets, defaultV interface{}) (*Response, string, error) {
+	return s.ReceiveTargetsWithContext(context.Background(), targets, defaultV)
+}
+
+// ReceiveTargetsWithContext is ReceiveTargets with a context for the request.
+func (s *Sling) ReceiveTargetsWithContext(ctx context.Context, targets Targets, defaultV interface{}) (*Response, string, error) {
+	parsed, err := parseTargets(targets)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	req, err := s.requestWithContext(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	values := []interface{}{defaultV}
+	for _, target := range parsed {
+		values = append(values, target.v)
+	}
+	var filled string
+	resp, decoded, err := s.doDecodeTarget(req, func(code int) interface{} {
+		for _, target := range parsed {
+			if target.min <= code && code <= target.max && target.v != nil {
+				filled = target.key
+				return target.v
+			}
+		}
+		if defaultV != nil {
+			filled = DefaultTarget
+		}
+		return defaultV
+	}, values...)
+	if !decoded {
+		return resp, "", err
+	}
+	return resp, filled, err
+}
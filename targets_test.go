@@ -0,0 +1,123 @@
+package sling
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseStatusRange(t *testing.T) {
+	cases := []struct {
+		key      string
+		min, max int
+		valid    bool
+	}{
+		{"200", 200, 200, true},
+		{"4XX", 400, 499, true},
+		{"5xx", 500, 599, true},
+		{"500-503", 500, 503, true},
+		{" 409 ", 409, 409, true},
+		{"default", 0, 0, false},
+		{"6XX", 0, 0, false},
+		{"99", 0, 0, false},
+		{"503-500", 0, 0, false},
+		{"4X9", 0, 0, false},
+	}
+	for _, c := range cases {
+		min, max, err := parseStatusRange(c.key)
+		if (err == nil) != c.valid || min != c.min || max != c.max {
+			t.Errorf("%q: expected %d-%d (valid %t), got %d-%d, %v", c.key, c.min, c.max, c.valid, min, max, err)
+		}
+	}
+}
+
+type Job struct {
+	ID string `json:"id"`
+}
+
+func TestReceiveTargets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		w.Header().Set(contentType, jsonContentType)
+		w.WriteHeader(code)
+		switch code {
+		case 204:
+		case 205:
+			// zero Content-Length
+		case 206:
+			fmt.Fprint(w, "not json")
+		default:
+			fmt.Fprintf(w, `{"id": "%d", "text": "text %d", "message": "message %d"}`, code, code, code)
+		}
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		code     int
+		useDef   bool
+		target   string
+		expected string
+		fails    bool
+	}{
+		{200, false, "200", "text 200", false},
+		{201, false, "2XX", "text 201", false},
+		{202, false, "202", "202", false},
+		{204, false, "", "", false},
+		{205, false, "", "", false},
+		// a target which fails to decode isn't reported
+		{206, false, "", "", true},
+		{409, false, "409", "message 409", false},
+		{422, false, "400-499", "message 422", false},
+		{503, false, "", "", true},
+		{503, true, DefaultTarget, "message 503", false},
+	}
+	for _, c := range cases {
+		model, job, conflict, invalid, fallback := new(FakeModel), new(Job), new(APIError), new(APIError), new(APIError)
+		targets := Targets{
+			"2XX":     model,
+			"200":     model,
+			"202":     job,
+			"409":     conflict,
+			"400-499": invalid,
+			"5XX":     nil,
+		}
+		var defaultV interface{}
+		if c.useDef {
+			defaultV = fallback
+		}
+		resp, target, err := New().Base(server.URL).Path(strconv.Itoa(c.code)).ReceiveTargets(targets, defaultV)
+		if (err != nil) != c.fails {
+			t.Errorf("%d: expected error %t, got %v", c.code, c.fails, err)
+		}
+		if resp == nil || resp.StatusCode != c.code {
+			t.Errorf("%d: expected a response, got %v", c.code, resp)
+		}
+		if target != c.target {
+			t.Errorf("%d: expected target %q, got %q", c.code, c.target, target)
+		}
+		var got string
+		switch target {
+		case "200", "2XX":
+			got = model.Text
+		case "202":
+			got = job.ID
+		case "409":
+			got = conflict.Message
+		case "400-499":
+			got = invalid.Message
+		case DefaultTarget:
+			got = fallback.Message
+		}
+		if got != c.expected {
+			t.Errorf("%d: expected %q, got %q", c.code, c.expected, got)
+		}
+	}
+
+	_, _, err := New().Base(server.URL).ReceiveTargets(Targets{"2YY": new(FakeModel)}, nil)
+	if err == nil || !strings.Contains(err.Error(), `invalid status code target "2YY"`) {
+		t.Errorf("expected an invalid target error, got %v", err)
+	}
+}
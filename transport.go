@@ -0,0 +1,337 @@
+package sling
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const unixScheme = "unix://"
+
+// unixHost is the placeholder host of URLs which are dialed through a unix
+// domain socket.
+const unixHost = "unix"
+
+// ContextDialer dials network connections. It is implemented by *net.Dialer.
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// contextDialer boxes a ContextDialer so transport settings stay comparable
+// for any dialer implementation.
+type contextDialer struct {
+	ContextDialer
+}
+
+// cookieJar boxes an http.CookieJar so transport settings stay
+// comparable for any jar implementation.
+type cookieJar struct {
+	http.CookieJar
+}
+
+// transportConfig holds the Sling's transport settings. When any are set,
+// the Sling sends requests with a copy of its http Client using a transport
+// built from these settings.
+type transportConfig struct {
+	// cookie jar of the copied http Client
+	jar *cookieJar
+	// strips credentials from cross-origin redirects
+	redirects *leakPolicy
+	// dialer used for new connections, nil for a default net.Dialer
+	dialer *contextDialer
+	// unix domain socket path all connections are dialed to
+	unixSocket string
+	// proxy URL, empty to keep the transport's proxy
+	proxy string
+	// base TLS config, nil to keep the transport's config
+	tlsConfig *tls.Config
+	// client certificate presented for mutual TLS
+	clientCert *tls.Certificate
+	// certificate authorities trusted for server certificates
+	rootCAs *x509.CertPool
+	// blocks connections to internal addresses
+	addressPolicy *addressPolicy
+	// public key pins of hosts
+	pins *pinSet
+}
+
+// transportKey identifies a Transport built from a base Transport and
+// settings.
+type transportKey struct {
+	base   *http.Transport
+	config transportConfig
+}
+
+// transportCache caches Transports built from transport settings so that
+// connections are pooled. A Sling shares its cache with its children.
+type transportCache struct {
+	mu         sync.Mutex
+	transports map[transportKey]*http.Transport
+}
+
+func newTransportCache() *transportCache {
+	return &transportCache{transports: make(map[transportKey]*http.Transport)}
+}
+
+// transport returns the cached Transport for the base Transport and
+// settings, building it on first use. A nil base is the default transport.
+func (c *transportCache) transport(base *http.Transport, config transportConfig) (*http.Transport, error) {
+	key := transportKey{base: base, config: config}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if transport, ok := c.transports[key]; ok {
+		return transport, nil
+	}
+	transport, err := newConfiguredTransport(base, config)
+	if err != nil {
+		return nil, err
+	}
+	c.transports[key] = transport
+	return transport, nil
+}
+
+// configuredClient returns a copy of the base Client with the settings
+// applied, using a cached Transport if there are transport settings.
+func (c *transportCache) configuredClient(base *http.Client, config transportConfig) (*http.Client, error) {
+	client := *base
+	if config.jar != nil {
+		client.Jar = config.jar.CookieJar
+	}
+	if config.redirects != nil {
+		client.CheckRedirect = config.redirects.checkRedirect(base.CheckRedirect)
+	}
+	transportSettings := config
+	transportSettings.jar, transportSettings.redirects = nil, nil
+	if transportSettings == (transportConfig{}) {
+		// Client settings alone don't need a new transport
+		return &client, nil
+	}
+
+	var baseTransport *http.Transport
+	switch rt := base.Transport.(type) {
+	case nil:
+	case *http.Transport:
+		baseTransport = rt
+	default:
+		return nil, fmt.Errorf("sling: transport settings require an *http.Transport, got %T", rt)
+	}
+	transport, err := c.transport(baseTransport, transportSettings)
+	if err != nil {
+		return nil, err
+	}
+	client.Transport = transport
+	return &client, nil
+}
+
+// newConfiguredTransport returns a clone of the base Transport, or of the
+// default transport if it is nil, with the settings applied.
+func newConfiguredTransport(base *http.Transport, config transportConfig) (*http.Transport, error) {
+	if base == nil {
+		base = http.DefaultTransport.(*http.Transport)
+	}
+	transport := base.Clone()
+
+	var dialer ContextDialer = &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if transport.DialContext != nil {
+		// keep the base Transport's own dialing unless a Dialer replaces it
+		dialer = dialerFunc(transport.DialContext)
+	}
+	if config.dialer != nil {
+		dialer = config.dialer.ContextDialer
+	}
+	if config.addressPolicy != nil {
+		dialer = config.addressPolicy.dialer(dialer)
+	}
+	transport.DialContext = dialer.DialContext
+	if config.unixSocket != "" {
+		socket := config.unixSocket
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+		// a proxy would be dialed through the socket instead of the target
+		transport.Proxy = nil
+	}
+
+	if config.proxy != "" && config.unixSocket == "" {
+		proxyURL, err := url.Parse(config.proxy)
+		if err != nil {
+			return nil, fmt.Errorf("sling: invalid proxy url: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if config.addressPolicy != nil && config.proxy == "" {
+		// only the address of a proxy would be checked, not the target's
+		transport.Proxy = nil
+	}
+
+	if config.tlsConfig != nil || config.clientCert != nil || config.rootCAs != nil || config.pins != nil {
+		tlsConfig := config.tlsConfig
+		if tlsConfig == nil {
+			tlsConfig = transport.TLSClientConfig
+		}
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		tlsConfig = tlsConfig.Clone()
+		if config.clientCert != nil {
+			tlsConfig.Certificates = append(tlsConfig.Certificates, *config.clientCert)
+		}
+		if config.rootCAs != nil {
+			tlsConfig.RootCAs = config.rootCAs
+		}
+		if config.pins != nil {
+			tlsConfig.VerifyConnection = config.pins.verifyConnection(tlsConfig.VerifyConnection)
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	return transport, nil
+}
+
+// Dialer sets the dialer used for new connections.
+func (s *Sling) Dialer(dialer ContextDialer) *Sling {
+	if dialer == nil {
+		s.transport.dialer = nil
+		return s
+	}
+	s.transport.dialer = &contextDialer{dialer}
+	return s
+}
+
+// UnixSocket sets a unix domain socket path which all connections are dialed
+// to, whatever the host of the request URL. See Base for setting the socket
+// and URL together. Setting a Base which isn't a unix URL clears the socket.
+func (s *Sling) UnixSocket(path string) *Sling {
+	s.transport.unixSocket = path
+	return s
+}
+
+// Proxy sets the URL of the proxy requests are sent through, such as
+// "http://proxy.internal:3128". An empty rawURL keeps the http Client's
+// proxy (by default from the environment).
+func (s *Sling) Proxy(rawURL string) *Sling {
+	s.transport.proxy = rawURL
+	return s
+}
+
+// TLSConfig sets the TLS configuration for new connections. A nil config
+// keeps the http Client's TLS configuration. Transports are cached by the
+// config pointer and clone the config when they are built, so reuse one
+// config rather than modifying it once requests have been sent.
+func (s *Sling) TLSConfig(config *tls.Config) *Sling {
+	s.transport.tlsConfig = config
+	return s
+}
+
+// ClientCertificate sets the certificate presented to servers which request
+// one, for mutual TLS.
+func (s *Sling) ClientCertificate(cert tls.Certificate) *Sling {
+	s.transport.clientCert = internCertificate(cert)
+	return s
+}
+
+// clientCertificates holds the client certificates set on Slings by the
+// hash of their chain, so that Slings setting the same certificate share a
+// cached transport.
+var clientCertificates sync.Map
+
+// internCertificate returns the held certificate with the same chain as
+// cert, holding cert if there is none.
+func internCertificate(cert tls.Certificate) *tls.Certificate {
+	h := sha256.New()
+	for _, der := range cert.Certificate {
+		binary.Write(h, binary.BigEndian, uint32(len(der)))
+		h.Write(der)
+	}
+	var key [sha256.Size]byte
+	h.Sum(key[:0])
+	held, _ := clientCertificates.LoadOrStore(key, &cert)
+	return held.(*tls.Certificate)
+}
+
+// RootCAs sets the certificate authorities trusted to verify server
+// certificates, replacing the system pool.
+func (s *Sling) RootCAs(pool *x509.CertPool) *Sling {
+	s.transport.rootCAs = pool
+	return s
+}
+
+// Timeout sets a time limit for each request sent by the Sling, including
+// reading the response body. The limit is applied through the request
+// context, so it combines with any deadline of the context passed to
+// ReceiveWithContext or Do. Zero means no limit.
+func (s *Sling) Timeout(timeout time.Duration) *Sling {
+	s.timeout = timeout
+	return s
+}
+
+// withTimeout returns a context limited by the Sling's timeout, if any.
+func (s *Sling) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, s.timeout)
+}
+
+// cancelOnClose cancels a request context when the response body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// parseUnixURL splits a "unix://<socket path>:<http path>" URL into the
+// socket path and an http URL for the path. If there is no ":" after the
+// socket path, the http path is "/".
+func parseUnixURL(rawURL string) (socket, httpURL string) {
+	rest := strings.TrimPrefix(rawURL, unixScheme)
+	path := "/"
+	if colon := strings.IndexByte(rest, ':'); colon >= 0 {
+		rest, path = rest[:colon], rest[colon+1:]
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+	}
+	return rest, "http://" + unixHost + path
+}
+
+// httpDoer returns the Doer requests are sent with before middleware is
+// applied. When transport settings are set, it is a copy of the Sling's http
+// Client, made for each request, using a cached transport with those
+// settings.
+func (s *Sling) httpDoer() (Doer, error) {
+	config := s.transport
+	if _, ok := s.httpClient.(*http.Client); ok && s.hasCredentials() {
+		config.redirects = s.leakPolicy()
+	}
+	if config == (transportConfig{}) {
+		return s.httpClient, nil
+	}
+	var base *http.Client
+	switch doer := s.httpClient.(type) {
+	case nil:
+		base = http.DefaultClient
+	case *http.Client:
+		base = doer
+	default:
+		return nil, fmt.Errorf("sling: transport settings require an *http.Client, got %T", doer)
+	}
+	if s.transports == nil {
+		s.transports = newTransportCache()
+	}
+	return s.transports.configuredClient(base, config)
+}
@@ -0,0 +1,266 @@
+package sling
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseUnixURL(t *testing.T) {
+	cases := []struct {
+		rawURL          string
+		expectedSocket  string
+		expectedHTTPURL string
+	}{
+		{"unix:///var/run/agent.sock:/v1/", "/var/run/agent.sock", "http://unix/v1/"},
+		{"unix:///var/run/agent.sock", "/var/run/agent.sock", "http://unix/"},
+		{"unix:///var/run/agent.sock:v1/", "/var/run/agent.sock", "http://unix/v1/"},
+		{"unix://agent.sock:/", "agent.sock", "http://unix/"},
+	}
+	for _, c := range cases {
+		socket, httpURL := parseUnixURL(c.rawURL)
+		if socket != c.expectedSocket {
+			t.Errorf("expected %s, got %s", c.expectedSocket, socket)
+		}
+		if httpURL != c.expectedHTTPURL {
+			t.Errorf("expected %s, got %s", c.expectedHTTPURL, httpURL)
+		}
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets not supported: %v", err)
+	}
+	server := http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assertMethod(t, "GET", r)
+		fmt.Fprintf(w, `{"text": "%s"}`, r.URL.Path)
+	})}
+	go server.Serve(ln)
+	defer server.Shutdown(context.Background())
+
+	base := New().Base("unix://" + socket + ":/v1/")
+	if base.rawURL != "http://unix/v1/" {
+		t.Errorf("expected http://unix/v1/, got %s", base.rawURL)
+	}
+
+	model := new(FakeModel)
+	if _, err := base.New().Get("status").ReceiveSuccess(model); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if model.Text != "/v1/status" {
+		t.Errorf("expected /v1/status, got %s", model.Text)
+	}
+
+	// another base is no longer dialed through the socket
+	for _, s := range []*Sling{base.New().Base("https://api.example.com/"), New().Base("unix://" + socket).Base("http://example.com/")} {
+		if s.transport.unixSocket != "" {
+			t.Errorf("expected the socket to be cleared, got %s", s.transport.unixSocket)
+		}
+	}
+	if base.transport.unixSocket != socket {
+		t.Errorf("expected the parent to keep its socket, got %s", base.transport.unixSocket)
+	}
+	// a socket set after Base is kept
+	if s := New().Base("http://localhost/").UnixSocket(socket); s.transport.unixSocket != socket {
+		t.Errorf("expected the socket to be kept, got %s", s.transport.unixSocket)
+	}
+}
+
+type countingDialer struct {
+	net.Dialer
+	count int32
+}
+
+func (d *countingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	atomic.AddInt32(&d.count, 1)
+	return d.Dialer.DialContext(ctx, network, address)
+}
+
+func TestDialer(t *testing.T) {
+	_, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/foo", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"text": "Some text"}`)
+	})
+
+	dialer := &countingDialer{}
+	base := New().Base(server.URL + "/").Dialer(dialer)
+	for i := 0; i < 3; i++ {
+		if _, err := base.New().Get("foo").ReceiveSuccess(&FakeModel{}); err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+	}
+	// children share the cached transport, so the connection is reused
+	if count := atomic.LoadInt32(&dialer.count); count != 1 {
+		t.Errorf("expected 1 dial, got %d", count)
+	}
+}
+
+func TestTransportSettings_baseDialContext(t *testing.T) {
+	_, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/foo", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"text": "Some text"}`)
+	})
+
+	dialer := &countingDialer{}
+	client := &http.Client{Transport: &http.Transport{DialContext: dialer.DialContext}}
+	s := New().Client(client).RootCAs(x509.NewCertPool()).Get(server.URL + "/foo")
+	if _, err := s.ReceiveSuccess(&FakeModel{}); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	// the base Transport's DialContext is kept
+	if count := atomic.LoadInt32(&dialer.count); count != 1 {
+		t.Errorf("expected 1 dial, got %d", count)
+	}
+}
+
+func TestTransportSettings_cache(t *testing.T) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	cert := tls.Certificate{Certificate: [][]byte{{1, 2, 3}}}
+	api := New()
+	var transport http.RoundTripper
+	for i := 0; i < 3; i++ {
+		// settings set per request share one transport
+		doer, err := api.New().TLSConfig(config).ClientCertificate(cert).httpDoer()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 && doer.(*http.Client).Transport != transport {
+			t.Errorf("expected request %d to reuse the cached transport", i)
+		}
+		transport = doer.(*http.Client).Transport
+	}
+	if count := len(api.transports.transports); count != 1 {
+		t.Errorf("expected 1 cached transport, got %d", count)
+	}
+
+	// the Client copy follows changes to the Sling's Client
+	client := &http.Client{}
+	s := New().Client(client).TLSConfig(config)
+	first, _ := s.httpDoer()
+	client.Timeout = 5 * time.Second
+	second, _ := s.httpDoer()
+	if second.(*http.Client).Timeout != 5*time.Second {
+		t.Errorf("expected the Client's new Timeout, got %v", second.(*http.Client).Timeout)
+	}
+	if first.(*http.Client).Transport != second.(*http.Client).Transport {
+		t.Errorf("expected the cached transport to be reused")
+	}
+}
+
+func TestTransportSettings_customDoer(t *testing.T) {
+	s := New().Doer(&fakeDoer{}).UnixSocket("/tmp/agent.sock").Get("http://a.io/")
+	if _, err := s.ReceiveSuccess(&FakeModel{}); err == nil {
+		t.Errorf("expected error using transport settings with a custom Doer")
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	release := make(chan struct{})
+	defer close(release)
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+
+	s := New().Client(client).Get("http://example.com/slow").Timeout(10 * time.Millisecond)
+	_, err := s.ReceiveSuccess(&FakeModel{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	_, err = s.Do(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestProxy(t *testing.T) {
+	_, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/foo", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"text": "%s"}`, r.Host)
+	})
+
+	model := new(FakeModel)
+	_, err := New().Proxy(server.URL).Get("http://example.com/foo").ReceiveSuccess(model)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if model.Text != "example.com" {
+		t.Errorf("expected request to be proxied, got host %s", model.Text)
+	}
+}
+
+func TestTLSSettings(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"text": "%s"}`, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	// without trusting the server certificate
+	if _, err := New().Get(server.URL).ReceiveSuccess(&FakeModel{}); err == nil {
+		t.Errorf("expected certificate verification error")
+	}
+
+	// without a client certificate
+	base := New().Base(server.URL + "/").RootCAs(roots)
+	if _, err := base.New().Get("foo").ReceiveSuccess(&FakeModel{}); err == nil {
+		t.Errorf("expected client certificate error")
+	}
+
+	cert := newTestCertificate(t, "client")
+	model := new(FakeModel)
+	if _, err := base.New().ClientCertificate(cert).Get("foo").ReceiveSuccess(model); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if model.Text != "client" {
+		t.Errorf("expected client, got %s", model.Text)
+	}
+}
+
+// newTestCertificate returns a self-signed certificate for the common name.
+func newTestCertificate(t *testing.T, commonName string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}